@@ -0,0 +1,60 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/paketo-buildpacks/ubi-nodejs-extension/constants"
+	"github.com/paketo-buildpacks/ubi-nodejs-extension/internal/utils"
+)
+
+// inspect-catalog prints the Node.js run images declared on an images.json
+// file and exits with a non-zero code when the catalog is not consistent.
+func main() {
+	imagesJsonPath := flag.String("images-json", constants.IMAGES_JSON_PATH, "path to the images.json file of the builder")
+	flag.Parse()
+
+	imagesJsonData, err := utils.ParseImagesJsonFile(*imagesJsonPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to parse %s: %s\n", *imagesJsonPath, err)
+		os.Exit(1)
+	}
+
+	// The run images can only be listed when every nodejs stack name is valid
+	if nodejsStacks, err := utils.GetNodejsStackImages(imagesJsonData); err == nil {
+		writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(writer, "NODE MAJOR\tVARIANT\tUBI\tDEFAULT\tSTACK\tPLATFORM\tRUN IMAGE")
+		for _, stack := range nodejsStacks {
+			variant := stack.Variant
+			if variant == "" {
+				variant = "-"
+			}
+
+			distroVersion := stack.DistroVersion
+			if distroVersion == "" {
+				distroVersion = "*"
+			}
+
+			platforms := stack.Platforms
+			if len(platforms) == 0 {
+				platforms = []string{"*"}
+			}
+
+			for _, platform := range platforms {
+				fmt.Fprintf(writer, "%s\t%s\t%s\t%t\t%s\t%s\t%s\n", stack.NodeVersion, variant, distroVersion, stack.IsDefaultRunImage, stack.Name, platform, utils.GetStackRunImage(stack, platform))
+			}
+		}
+		writer.Flush()
+	}
+
+	problems := utils.ValidateImagesJson(imagesJsonData)
+	if len(problems) > 0 {
+		fmt.Fprintf(os.Stderr, "\nfound %d problem(s) on %s:\n", len(problems), *imagesJsonPath)
+		for _, problem := range problems {
+			fmt.Fprintf(os.Stderr, "  - %s\n", problem)
+		}
+		os.Exit(1)
+	}
+}
@@ -2,3 +2,18 @@ package constants
 
 const DEFAULT_USER_ID = 1002
 const DEFAULT_GROUP_ID = 1000
+const IMAGES_JSON_PATH = "/etc/buildpacks/images.json"
+const GENERATE_REPORT_FILENAME = "generate-report.toml"
+const GENERATE_REPORT_LABEL = "io.paketo.ubi-nodejs.generate-report"
+const GENERATE_REPORT_BUILD_ARG = "ubi_nodejs_generate_report"
+const NODEJS_VERSION_LABEL = "io.paketo.ubi-nodejs.version"
+const NODEJS_MAJOR_VERSION_LABEL = "io.paketo.ubi-nodejs.major-version"
+const SOURCE_IMAGE_LABEL = "io.paketo.ubi-nodejs.source-image"
+const EXTENSION_VERSION_LABEL = "io.paketo.ubi-nodejs.extension-version"
+const OCI_BASE_NAME_LABEL = "org.opencontainers.image.base.name"
+const OS_RELEASE_PATH = "/etc/os-release"
+const DEFAULT_DISTRO_VERSION = "8"
+const DOCKERFILE_TEMPLATES_DIR = "ubi-nodejs-extension"
+const BUILD_DOCKERFILE_FRAGMENTS_DIR = ".ubi/build.Dockerfile.d"
+const RUN_DOCKERFILE_FRAGMENTS_DIR = ".ubi/run.Dockerfile.d"
+const NPM_TARBALLS_DIR = "ubi-nodejs-extension/npm"
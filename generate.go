@@ -1,21 +1,51 @@
 package ubinodejsextension
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"slices"
 	"strings"
 
+	"github.com/paketo-buildpacks/ubi-nodejs-extension/constants"
 	"github.com/paketo-buildpacks/ubi-nodejs-extension/internal/utils"
 	"github.com/paketo-buildpacks/ubi-nodejs-extension/structs"
 
 	"github.com/Masterminds/semver/v3"
 	"github.com/paketo-buildpacks/libnodejs"
 	"github.com/paketo-buildpacks/packit/v2"
+	"github.com/paketo-buildpacks/packit/v2/chronos"
 	"github.com/paketo-buildpacks/packit/v2/draft"
 	postal "github.com/paketo-buildpacks/packit/v2/postal"
 	"github.com/paketo-buildpacks/packit/v2/scribe"
 )
 
 const PACKAGES = "make gcc gcc-c++ libatomic_ops git openssl-devel nodejs npm nodejs-nodemon nss_wrapper which python3"
+const UBI10_PACKAGES = "make gcc gcc-c++ libatomic_ops git openssl-devel nodejs npm nss_wrapper-libs which python3"
+const FIPS_PACKAGES = "crypto-policies-scripts"
+const FULL_ICU_PACKAGES = "nodejs-full-i18n"
+
+// Packages of the nodejs module stream installed through its profile when BP_UBI_NODE_PROFILE is set
+const NODEJS_MODULE_PACKAGES = "nodejs npm nodejs-nodemon"
+
+const NATIVE_BUILD_PACKAGES = "make gcc gcc-c++ python3"
+
+// nodejs-devel provides the headers node-gyp would otherwise download from nodejs.org
+const NODEJS_HEADERS_PACKAGES = "nodejs-devel"
+
+var NODEJS_PROFILES = []string{"common", "minimal", "development", "s2i"}
+
+// UBI 9 ships Node.js 16 as plain packages and UBI 10 has no modularity anymore,
+// shipping the Node.js versions other than the default one as versioned packages
+var UBI_DISTROS = map[string]structs.UbiDistro{
+	"8":  {ModuleStreams: true, Packages: PACKAGES},
+	"9":  {ModuleStreams: true, DefaultNodeVersion: 16, Packages: PACKAGES},
+	"10": {ModuleStreams: false, DefaultNodeVersion: 22, Packages: UBI10_PACKAGES},
+}
+
 const CONFIG_TOML_PATH = "/tmp/config.toml"
 
 //go:generate faux --interface DependencyManager --output fakes/dependency_manager.go
@@ -25,82 +55,548 @@ type DependencyManager interface {
 	GenerateBillOfMaterials(dependencies ...postal.Dependency) []packit.BOMEntry
 }
 
-func Generate(dependencyManager DependencyManager, logger scribe.Emitter, duringBuildPermissions structs.DuringBuildPermissions, imagesJsonPath string) packit.GenerateFunc {
+// nodeResolution is the Node.js version selected for the app, along with how
+// it has been selected.
+type nodeResolution struct {
+	RequestedVersion     string
+	VersionSource        string
+	DefaultVersionPolicy string
+	VersionFallback      string
+	Candidates           []packit.BuildpackPlanEntry
+	Dependency           postal.Dependency
+	MajorVersion         uint64
+}
+
+// packageSelection is what is installed on the build and the run images.
+type packageSelection struct {
+	Packages         []string
+	RunPackages      []string
+	NativePackages   []string
+	Profile          string
+	ModuleStream     bool
+	NodePreinstalled bool
+	NodejsHeaders    bool
+	FIPS             bool
+	FullICU          bool
+}
+
+func Generate(dependencyManager DependencyManager, logger scribe.Emitter, duringBuildPermissions structs.DuringBuildPermissions, imagesJsonPath string, buildImage structs.BuildImage, clock chronos.Clock) packit.GenerateFunc {
 	return func(context packit.GenerateContext) (packit.GenerateResult, error) {
 
 		logger.Title("%s %s", context.Info.Name, context.Info.Version)
 		logger.Process("Resolving Node Engine version")
 
-		// Find the version with the highest priority
-		entryResolver := draft.NewPlanner()
-		highestPriorityNodeVersion, allNodeVersionsInPriorityOrder := libnodejs.ResolveNodeVersion(entryResolver.Resolve, context.Plan)
-		if highestPriorityNodeVersion.Name == "" {
+		if !slices.ContainsFunc(context.Plan.Entries, func(entry packit.BuildpackPlanEntry) bool { return entry.Name == "node" }) {
 			return packit.GenerateResult{}, packit.Fail.WithMessage("Node.js no longer requested by build plan")
 		}
 
-		logger.Candidates(allNodeVersionsInPriorityOrder)
+		projectPath, err := libnodejs.FindProjectPath(context.WorkingDir)
+		if err != nil {
+			return packit.GenerateResult{}, err
+		}
 
-		configTomlFileContent, err := utils.GenerateConfigTomlContentFromImagesJson(imagesJsonPath, context.Stack)
+		distroVersion := utils.GetDistroMajorVersion(buildImage.Distro)
+		platform := utils.GetTargetPlatform()
+
+		ubiDistro, err := utils.GetUbiDistro(UBI_DISTROS, distroVersion)
 		if err != nil {
 			return packit.GenerateResult{}, err
 		}
 
-		//save config.toml file
-		err = os.WriteFile(CONFIG_TOML_PATH, configTomlFileContent, 0644)
+		packageManager, err := utils.GetPackageManager(buildImage.PackageManager)
 		if err != nil {
 			return packit.GenerateResult{}, err
 		}
 
-		nodeVersion, _ := highestPriorityNodeVersion.Metadata["version"].(string)
-		dependency, err := dependencyManager.Resolve(CONFIG_TOML_PATH, highestPriorityNodeVersion.Name, nodeVersion, context.Stack)
+		node, err := resolveNodeVersion(dependencyManager, logger, clock, context, projectPath, imagesJsonPath, platform, distroVersion)
 		if err != nil {
 			return packit.GenerateResult{}, err
 		}
 
-		selectedNodeVersion, err := semver.NewVersion(dependency.Version)
+		nodeAtLaunch := utils.IsNodeRequiredAtLaunch(context.Plan.Entries)
+		runImage, err := utils.SelectRunImage(logger, nodeAtLaunch, node.Dependency.Source)
 		if err != nil {
 			return packit.GenerateResult{}, err
 		}
-		selectedNodeMajorVersion := selectedNodeVersion.Major()
 
-		var selectedNodeRunImage string
+		logger.Process("Selected Node Engine Major version %d", node.MajorVersion)
 
-		bpNodeRunExtension, bpNodeRunExtensionEnvExists := os.LookupEnv("BP_UBI_RUN_IMAGE_OVERRIDE")
-		if !bpNodeRunExtensionEnvExists || bpNodeRunExtension == "" {
-			selectedNodeRunImage = dependency.Source
-		} else {
-			logger.Process("Using run image specified by BP_UBI_RUN_IMAGE_OVERRIDE %s", bpNodeRunExtension)
-			selectedNodeRunImage = bpNodeRunExtension
+		versionConflicts, err := checkVersionConflicts(logger, node, imagesJsonPath, platform, distroVersion)
+		if err != nil {
+			return packit.GenerateResult{}, err
 		}
 
-		logger.Process("Selected Node Engine Major version %d", selectedNodeMajorVersion)
+		selection, err := assemblePackages(logger, projectPath, ubiDistro, packageManager, buildImage, node.MajorVersion, nodeAtLaunch, distroVersion)
+		if err != nil {
+			return packit.GenerateResult{}, err
+		}
 
-		// Generating build.Dockerfile
-		buildDockerfileContent, err := utils.GenerateBuildDockerfile(structs.BuildDockerfileProps{
-			NODEJS_VERSION: selectedNodeMajorVersion,
-			CNB_USER_ID:    duringBuildPermissions.CNB_USER_ID,
-			CNB_GROUP_ID:   duringBuildPermissions.CNB_GROUP_ID,
-			CNB_STACK_ID:   context.Stack,
-			PACKAGES:       PACKAGES,
-		})
+		caCertificates, err := utils.GetCACertificatesFromBindings(context.Platform.Path)
+		if err != nil {
+			return packit.GenerateResult{}, err
+		}
+
+		var caCertificateNames []string
+		for _, caCertificate := range caCertificates {
+			caCertificateNames = append(caCertificateNames, caCertificate.Name)
+		}
+
+		if len(caCertificates) > 0 {
+			logger.Process("Adding %d CA certificate(s) from the ca-certificates bindings to the build image", len(caCertificates))
+			logger.Subprocess(strings.Join(caCertificateNames, ", "))
+		}
 
+		npm, err := utils.SelectNpmInstallation(logger, projectPath, node.MajorVersion, filepath.Join(filepath.Dir(imagesJsonPath), constants.NPM_TARBALLS_DIR))
 		if err != nil {
 			return packit.GenerateResult{}, err
 		}
 
-		// Generating run.Dockerfile
-		runDockerfileContent, err := utils.GenerateRunDockerfile(structs.RunDockerfileProps{
-			Source: selectedNodeRunImage,
-		})
+		dockerfileTemplates, err := utils.GetDockerfileTemplates(filepath.Join(filepath.Dir(imagesJsonPath), constants.DOCKERFILE_TEMPLATES_DIR))
+		if err != nil {
+			return packit.GenerateResult{}, err
+		}
+
+		if dockerfileTemplates.BuildSource != "embedded" {
+			logger.Process("Using the build Dockerfile template %s", dockerfileTemplates.BuildSource)
+		}
+		if dockerfileTemplates.RunSource != "embedded" {
+			logger.Process("Using the run Dockerfile template %s", dockerfileTemplates.RunSource)
+		}
+
+		buildFragments, buildFragmentNames, err := utils.LoadDockerfileFragments(context.WorkingDir, constants.BUILD_DOCKERFILE_FRAGMENTS_DIR, duringBuildPermissions)
+		if err != nil {
+			return packit.GenerateResult{}, err
+		}
+
+		runFragments, runFragmentNames, err := utils.LoadDockerfileFragments(context.WorkingDir, constants.RUN_DOCKERFILE_FRAGMENTS_DIR, duringBuildPermissions)
+		if err != nil {
+			return packit.GenerateResult{}, err
+		}
 
+		if runImage.Image == "" && len(runFragments) > 0 {
+			logger.Process("WARNING: Ignoring the run Dockerfile fragments of the app as the run image of the builder is kept")
+			logger.Subprocess(strings.Join(runFragmentNames, ", "))
+			runFragments, runFragmentNames = nil, nil
+		}
+
+		if len(buildFragments) > 0 {
+			logger.Process("Applying the build Dockerfile fragments of the app")
+			logger.Subprocess(strings.Join(buildFragmentNames, ", "))
+		}
+		if len(runFragments) > 0 {
+			logger.Process("Applying the run Dockerfile fragments of the app")
+			logger.Subprocess(strings.Join(runFragmentNames, ", "))
+		}
+
+		generateReport := structs.GenerateReport{
+			NodeRequestedVersion: node.RequestedVersion,
+			NodeVersionSource:    node.VersionSource,
+			DefaultVersionPolicy: node.DefaultVersionPolicy,
+			NodeVersionFallback:  node.VersionFallback,
+			NodeVersionConflicts: versionConflicts,
+			NodeMajorVersion:     node.MajorVersion,
+			NodeProfile:          selection.Profile,
+			NodeLaunch:           nodeAtLaunch,
+			NodePreinstalled:     selection.NodePreinstalled,
+			NpmVersion:           npm.Installation.Version,
+			NpmVersionSource:     npm.VersionSource,
+			RunImage:             runImage.Image,
+			RunImageSource:       runImage.Source,
+			Packages:             selection.Packages,
+			ImagesJsonPath:       imagesJsonPath,
+			Platform:             platform,
+			Distro:               buildImage.Distro.Name,
+			DistroVersion:        distroVersion,
+			PackageManager:       packageManager.Name,
+			BuildTemplate:        dockerfileTemplates.BuildSource,
+			RunTemplate:          dockerfileTemplates.RunSource,
+			BuildFragments:       buildFragmentNames,
+			RunFragments:         runFragmentNames,
+			FIPS:                 selection.FIPS,
+			FullICU:              selection.FullICU,
+			CACertificates:       caCertificateNames,
+			NativePackages:       selection.NativePackages,
+			RunPackages:          selection.RunPackages,
+		}
+
+		generateReportJson, err := json.Marshal(generateReport)
 		if err != nil {
 			return packit.GenerateResult{}, err
 		}
 
+		buildDockerfileContent, err := utils.RenderBuildDockerfile(dockerfileTemplates, structs.BuildDockerfileProps{
+			NODEJS_VERSION:   node.MajorVersion,
+			CNB_USER_ID:      duringBuildPermissions.CNB_USER_ID,
+			CNB_GROUP_ID:     duringBuildPermissions.CNB_GROUP_ID,
+			CNB_STACK_ID:     context.Stack,
+			CNB_TARGET:       utils.GetTargetDescription(platform, buildImage.Distro),
+			PACKAGES:         strings.Join(selection.Packages, " "),
+			NODEJS_PROFILE:   selection.Profile,
+			NODEJS_INSTALLED: selection.NodePreinstalled,
+			NODEJS_HEADERS:   selection.NodejsHeaders,
+			NON_MODULAR:      !selection.ModuleStream,
+			PACKAGE_MANAGER:  packageManager.Commands(),
+			FIPS:             selection.FIPS,
+			FULL_ICU:         selection.FullICU,
+			NPM_PACKAGE:      npm.Installation.Package,
+			NPM_REGISTRY:     npm.Registry,
+			CA_CERTIFICATES:  caCertificates,
+			GENERATE_REPORT:  true,
+		}, buildFragments, context.WorkingDir, duringBuildPermissions)
+		if err != nil {
+			return packit.GenerateResult{}, err
+		}
+
+		// No build.Dockerfile is needed when the build image already meets every requirement
+		var buildDockerfile io.Reader
+		if selection.NodePreinstalled && len(selection.Packages) == 0 && !selection.NodejsHeaders && !selection.FIPS && !selection.FullICU && npm.Installation.Package == "" && len(caCertificates) == 0 && len(buildFragments) == 0 && dockerfileTemplates.BuildSource == "embedded" {
+			logger.Process("Skipping the extension of the build image as it already provides all the requirements")
+		} else {
+			buildDockerfile = strings.NewReader(buildDockerfileContent)
+		}
+
+		if outputDir := os.Getenv("CNB_OUTPUT_DIR"); outputDir != "" {
+			if err := utils.WriteGenerateReport(outputDir, generateReport); err != nil {
+				return packit.GenerateResult{}, err
+			}
+		}
+
+		// No run.Dockerfile is needed when the run image of the builder is kept
+		var runDockerfile io.Reader
+		if runImage.Image != "" {
+			labels := utils.GetRunImageLabels(runImage.Image, context.Info.Version, node.MajorVersion, nodeAtLaunch)
+			labels[constants.GENERATE_REPORT_LABEL] = string(generateReportJson)
+
+			runDockerfileContent, err := utils.RenderRunDockerfile(dockerfileTemplates, structs.RunDockerfileProps{
+				Source:       runImage.Image,
+				Labels:       labels,
+				CNB_USER_ID:  duringBuildPermissions.CNB_USER_ID,
+				CNB_GROUP_ID: duringBuildPermissions.CNB_GROUP_ID,
+				FIPS:         selection.FIPS && nodeAtLaunch,
+				FULL_ICU:     selection.FullICU && nodeAtLaunch,
+				PACKAGES:     strings.Join(selection.RunPackages, " "),
+				// Run images are based on ubi-minimal, which only ships microdnf
+				PACKAGE_MANAGER: utils.MICRODNF.Commands(),
+			}, runFragments, context.WorkingDir, duringBuildPermissions)
+			if err != nil {
+				return packit.GenerateResult{}, err
+			}
+			runDockerfile = strings.NewReader(runDockerfileContent)
+		}
+
 		return packit.GenerateResult{
-			ExtendConfig:    packit.ExtendConfig{Build: packit.ExtendImageConfig{Args: []packit.ExtendImageConfigArg{}}},
-			BuildDockerfile: strings.NewReader(buildDockerfileContent),
-			RunDockerfile:   strings.NewReader(runDockerfileContent),
+			ExtendConfig: packit.ExtendConfig{Build: packit.ExtendImageConfig{Args: []packit.ExtendImageConfigArg{
+				{Name: constants.GENERATE_REPORT_BUILD_ARG, Value: string(generateReportJson)},
+			}}},
+			BuildDockerfile: buildDockerfile,
+			RunDockerfile:   runDockerfile,
 		}, nil
 	}
 }
+
+// resolveNodeVersion selects the Node.js version with the highest priority,
+// among the version files of the project and the engines.node ranges of its
+// workspaces, applying the default version policy when no version is
+// requested and the version fallback policy when the version is not offered.
+func resolveNodeVersion(dependencyManager DependencyManager, logger scribe.Emitter, clock chronos.Clock, context packit.GenerateContext, projectPath string, imagesJsonPath string, platform string, distroVersion string) (nodeResolution, error) {
+	versionFileEntries, err := utils.GetNodeVersionFileEntries(projectPath)
+	if err != nil {
+		return nodeResolution{}, err
+	}
+
+	workspaces, err := utils.GetWorkspaces(projectPath)
+	if err != nil {
+		return nodeResolution{}, err
+	}
+
+	if slices.ContainsFunc(workspaces, func(workspace utils.Workspace) bool { return workspace.NodeVersion != "" }) {
+		offeredMajorVersions, err := utils.GetOfferedNodeMajorVersions(imagesJsonPath, platform, distroVersion)
+		if err != nil {
+			return nodeResolution{}, err
+		}
+
+		workspacesMajorVersion, err := utils.GetWorkspacesNodeMajorVersion(workspaces, offeredMajorVersions)
+		if err != nil && os.Getenv("BP_NODE_VERSION") == "" {
+			return nodeResolution{}, fmt.Errorf("failed to resolve Node.js for platform %s on UBI %s: %w, available Node.js major versions are: %s", platform, distroVersion, err, utils.FormatMajorVersions(offeredMajorVersions))
+		} else if err != nil {
+			logger.Process("WARNING: %s", err)
+			logger.Subprocess("Ignoring the engines.node ranges of the workspaces as BP_NODE_VERSION is set")
+		} else {
+			logger.Subprocess("Node.js %d satisfies the engines.node ranges of the %d workspace packages", workspacesMajorVersion, len(workspaces))
+			versionFileEntries = append(versionFileEntries, packit.BuildpackPlanEntry{
+				Name:     "node",
+				Metadata: map[string]interface{}{"version": fmt.Sprint(workspacesMajorVersion), "version-source": "workspaces"},
+			})
+		}
+	}
+
+	entryResolver := draft.NewPlanner()
+	highestPriorityNodeVersion, allNodeVersionsInPriorityOrder := entryResolver.Resolve("node", append(slices.Clone(context.Plan.Entries), versionFileEntries...), utils.GetNodeVersionSourcePriorities())
+
+	logger.Candidates(allNodeVersionsInPriorityOrder)
+
+	targetStack := utils.GetTargetStack(context.Stack)
+	logger.Subprocess("Selecting Node.js run images offered for platform %s on UBI %s", platform, distroVersion)
+
+	nodeVersion, _ := highestPriorityNodeVersion.Metadata["version"].(string)
+	nodeVersionSource, _ := highestPriorityNodeVersion.Metadata["version-source"].(string)
+
+	defaultVersionPolicy := os.Getenv("BP_UBI_NODE_DEFAULT_VERSION_POLICY")
+	if defaultVersionPolicy == "" {
+		defaultVersionPolicy = "builder-default"
+	} else if !slices.Contains(utils.DEFAULT_VERSION_POLICIES, defaultVersionPolicy) {
+		return nodeResolution{}, fmt.Errorf("invalid default version policy %q set by BP_UBI_NODE_DEFAULT_VERSION_POLICY, supported policies are: %s", defaultVersionPolicy, strings.Join(utils.DEFAULT_VERSION_POLICIES, ", "))
+	}
+
+	versionFallbackPolicy := os.Getenv("BP_UBI_NODE_VERSION_FALLBACK")
+	if versionFallbackPolicy == "" {
+		versionFallbackPolicy = "fail"
+	} else if !slices.Contains(utils.VERSION_FALLBACK_POLICIES, versionFallbackPolicy) {
+		return nodeResolution{}, fmt.Errorf("invalid version fallback policy %q set by BP_UBI_NODE_VERSION_FALLBACK, supported policies are: %s", versionFallbackPolicy, strings.Join(utils.VERSION_FALLBACK_POLICIES, ", "))
+	}
+
+	// A default version is only needed, and has to be offered for the platform, when no version is requested
+	var defaultNodeVersion string
+	if nodeVersion == "" {
+		logger.Subprocess("No Node.js version requested, applying the %s default version policy", defaultVersionPolicy)
+		defaultNodeVersion, err = utils.GetDefaultNodeVersionForPlatform(imagesJsonPath, platform, distroVersion, defaultVersionPolicy, clock.Now())
+
+		// The release calendar embedded in the extension can be outdated, which must not break the build
+		var noMatchingVersionErr utils.NoMatchingDefaultVersionError
+		if errors.As(err, &noMatchingVersionErr) {
+			logger.Process("WARNING: %s", err)
+			logger.Subprocess("Falling back to the builder-default default version policy")
+			defaultVersionPolicy = "builder-default"
+			defaultNodeVersion, err = utils.GetDefaultNodeVersionForPlatform(imagesJsonPath, platform, distroVersion, defaultVersionPolicy, clock.Now())
+		}
+		if err != nil {
+			return nodeResolution{}, err
+		}
+	}
+
+	configTomlFileContent, err := utils.GenerateConfigTomlContentFromImagesJson(imagesJsonPath, targetStack, platform, distroVersion, defaultNodeVersion)
+	if err != nil {
+		return nodeResolution{}, err
+	}
+
+	//save config.toml file
+	err = os.WriteFile(CONFIG_TOML_PATH, configTomlFileContent, 0644)
+	if err != nil {
+		return nodeResolution{}, err
+	}
+
+	var nodeVersionFallback string
+	dependency, err := dependencyManager.Resolve(CONFIG_TOML_PATH, highestPriorityNodeVersion.Name, nodeVersion, targetStack)
+	if err != nil {
+		offeredMajorVersions, offeredErr := utils.GetOfferedNodeMajorVersions(imagesJsonPath, platform, distroVersion)
+		if offeredErr != nil {
+			return nodeResolution{}, offeredErr
+		}
+
+		if versionFallbackPolicy == "fail" || nodeVersion == "" {
+			return nodeResolution{}, fmt.Errorf("failed to resolve Node.js for platform %s on UBI %s: %w, available Node.js major versions are: %s", platform, distroVersion, err, utils.FormatMajorVersions(offeredMajorVersions))
+		}
+
+		fallbackMajorVersion, fallbackErr := utils.GetFallbackNodeMajorVersion(nodeVersion, offeredMajorVersions, versionFallbackPolicy, clock.Now())
+		if fallbackErr != nil {
+			return nodeResolution{}, fmt.Errorf("failed to resolve Node.js for platform %s on UBI %s: %w, available Node.js major versions are: %s", platform, distroVersion, fallbackErr, utils.FormatMajorVersions(offeredMajorVersions))
+		}
+
+		logger.Process("WARNING: Node.js %s requested by %s is not offered by the builder", nodeVersion, nodeVersionSource)
+		logger.Process("WARNING: Falling back to Node.js %d as BP_UBI_NODE_VERSION_FALLBACK is set to %s", fallbackMajorVersion, versionFallbackPolicy)
+
+		dependency, err = dependencyManager.Resolve(CONFIG_TOML_PATH, highestPriorityNodeVersion.Name, fmt.Sprintf("%d.*", fallbackMajorVersion), targetStack)
+		if err != nil {
+			return nodeResolution{}, fmt.Errorf("failed to resolve Node.js for platform %s on UBI %s: %w", platform, distroVersion, err)
+		}
+		nodeVersionFallback = versionFallbackPolicy
+	}
+
+	selectedNodeVersion, err := semver.NewVersion(dependency.Version)
+	if err != nil {
+		return nodeResolution{}, err
+	}
+
+	return nodeResolution{
+		RequestedVersion:     nodeVersion,
+		VersionSource:        nodeVersionSource,
+		DefaultVersionPolicy: defaultVersionPolicy,
+		VersionFallback:      nodeVersionFallback,
+		Candidates:           allNodeVersionsInPriorityOrder,
+		Dependency:           dependency,
+		MajorVersion:         selectedNodeVersion.Major(),
+	}, nil
+}
+
+// checkVersionConflicts warns about the lower priority sources requesting
+// another version than the selected one, failing instead when
+// BP_UBI_NODE_VERSION_STRICT is set to true.
+func checkVersionConflicts(logger scribe.Emitter, node nodeResolution, imagesJsonPath string, platform string, distroVersion string) ([]string, error) {
+	strictVersions, err := utils.GetBooleanEnv("BP_UBI_NODE_VERSION_STRICT")
+	if err != nil {
+		return nil, err
+	}
+
+	versionConflicts := utils.GetVersionConflicts(node.Candidates, node.MajorVersion)
+	if len(versionConflicts) == 0 {
+		return nil, nil
+	}
+
+	var versionConflictDescriptions []string
+	for _, versionConflict := range versionConflicts {
+		versionConflictDescriptions = append(versionConflictDescriptions, versionConflict.String())
+	}
+
+	offeredMajorVersions, err := utils.GetOfferedNodeMajorVersions(imagesJsonPath, platform, distroVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Process("WARNING: Node.js %d selected from %s conflicts with the versions requested by other sources", node.MajorVersion, node.VersionSource)
+	for _, versionConflictDescription := range versionConflictDescriptions {
+		logger.Subprocess(versionConflictDescription)
+	}
+
+	if satisfyingMajorVersions := utils.GetMajorVersionsSatisfyingAll(node.Candidates, offeredMajorVersions); len(satisfyingMajorVersions) > 0 {
+		logger.Subprocess("Node.js %s would satisfy all the requested versions", utils.FormatMajorVersions(satisfyingMajorVersions))
+	} else {
+		logger.Subprocess("No Node.js version offered by the builder satisfies all the requested versions")
+	}
+
+	if strictVersions {
+		return nil, fmt.Errorf("Node.js %d selected from %s conflicts with the versions requested by other sources as BP_UBI_NODE_VERSION_STRICT is set to true: %s", node.MajorVersion, node.VersionSource, strings.Join(versionConflictDescriptions, ", "))
+	}
+
+	return versionConflictDescriptions, nil
+}
+
+// assemblePackages selects the packages installed on the build and the run
+// images for the Node.js major version, the module profile, the native
+// modules of the app and the FIPS and full ICU options, only keeping the
+// packages missing from the build image when it already provides Node.js.
+func assemblePackages(logger scribe.Emitter, projectPath string, ubiDistro structs.UbiDistro, packageManager utils.PackageManager, buildImage structs.BuildImage, nodeMajorVersion uint64, nodeAtLaunch bool, distroVersion string) (packageSelection, error) {
+	nodejsProfile := os.Getenv("BP_UBI_NODE_PROFILE")
+	if nodejsProfile != "" && !slices.Contains(NODEJS_PROFILES, nodejsProfile) {
+		return packageSelection{}, fmt.Errorf("invalid Node.js module profile %q set by BP_UBI_NODE_PROFILE, supported profiles are: %s", nodejsProfile, strings.Join(NODEJS_PROFILES, ", "))
+	}
+
+	nodejsModuleStream := utils.IsNodejsModuleStream(ubiDistro, nodeMajorVersion)
+	if nodejsProfile != "" && !nodejsModuleStream {
+		return packageSelection{}, fmt.Errorf("BP_UBI_NODE_PROFILE can not be used as Node.js %d is not delivered as a module stream on UBI %s", nodeMajorVersion, distroVersion)
+	}
+
+	if nodejsModuleStream && !packageManager.ModuleStreams {
+		return packageSelection{}, fmt.Errorf("the %s package manager of the build image can not enable the nodejs:%d module stream", packageManager.Name, nodeMajorVersion)
+	}
+
+	packages := strings.Fields(ubiDistro.Packages)
+	runPackages := []string{}
+
+	if nodejsProfile != "" {
+		logger.Process("Selected Node.js module profile nodejs:%d/%s", nodeMajorVersion, nodejsProfile)
+		packages = slices.DeleteFunc(packages, func(pkg string) bool {
+			return slices.Contains(strings.Fields(NODEJS_MODULE_PACKAGES), pkg)
+		})
+	} else if nodejsModuleStream {
+		logger.Process("Using the default profile of the nodejs:%d module stream", nodeMajorVersion)
+	}
+
+	lockfileDependencies, err := utils.ReadLockfileDependencies(projectPath)
+	if err != nil {
+		return packageSelection{}, err
+	}
+
+	if lockfileDependencies.Lockfile == "" {
+		logger.Process("Installing the native build toolchain as no lockfile has been found")
+		packages = utils.AppendMissingPackages(packages, strings.Fields(NODEJS_HEADERS_PACKAGES)...)
+	} else if len(lockfileDependencies.NativePackages) > 0 {
+		logger.Process("Installing the native build toolchain required by packages of %s", lockfileDependencies.Lockfile)
+		logger.Subprocess(strings.Join(lockfileDependencies.NativePackages, ", "))
+		packages = utils.AppendMissingPackages(packages, strings.Fields(NODEJS_HEADERS_PACKAGES)...)
+	} else {
+		logger.Process("Skipping the native build toolchain as no package of %s compiles native code", lockfileDependencies.Lockfile)
+		packages = slices.DeleteFunc(packages, func(pkg string) bool {
+			return slices.Contains(strings.Fields(NATIVE_BUILD_PACKAGES), pkg)
+		})
+	}
+
+	skipEmbeddedMapping, err := utils.GetBooleanEnv("BP_UBI_SKIP_EMBEDDED_NATIVE_MODULES_MAPPING")
+	if err != nil {
+		return packageSelection{}, err
+	}
+
+	nativeModulesMapping, err := utils.GetNativeModulesMapping(os.Getenv("BP_UBI_NATIVE_MODULES_MAPPING"), !skipEmbeddedMapping)
+	if err != nil {
+		return packageSelection{}, err
+	}
+
+	buildSystemPackages, runSystemPackages, nativeModules := utils.GetNativeModulesSystemPackages(nativeModulesMapping, lockfileDependencies.Packages)
+	if len(nativeModules) > 0 {
+		logger.Process("Installing the system packages required by native modules")
+		logger.Subprocess("%s -> build: [%s], run: [%s]", strings.Join(nativeModules, ", "), strings.Join(buildSystemPackages, " "), strings.Join(runSystemPackages, " "))
+		packages = utils.AppendMissingPackages(packages, buildSystemPackages...)
+		if nodeAtLaunch {
+			runPackages = utils.AppendMissingPackages(runPackages, runSystemPackages...)
+		}
+	}
+
+	fipsEnabled, err := utils.GetBooleanEnv("BP_UBI_NODE_FIPS")
+	if err != nil {
+		return packageSelection{}, err
+	}
+
+	if fipsEnabled {
+		logger.Process("Enabling FIPS mode as BP_UBI_NODE_FIPS is set to true")
+		packages = utils.AppendMissingPackages(packages, strings.Fields(FIPS_PACKAGES)...)
+		if nodeAtLaunch {
+			runPackages = utils.AppendMissingPackages(runPackages, strings.Fields(FIPS_PACKAGES)...)
+		}
+	}
+
+	nodejsHeaders := slices.Contains(packages, "nodejs-devel")
+	if nodejsHeaders {
+		logger.Subprocess("Building native modules against the headers of nodejs-devel")
+	}
+
+	fullIcuEnabled, err := utils.GetBooleanEnv("BP_UBI_NODE_FULL_ICU")
+	if err != nil {
+		return packageSelection{}, err
+	}
+
+	if fullIcuEnabled {
+		logger.Process("Installing the full ICU data as BP_UBI_NODE_FULL_ICU is set to true")
+		packages = utils.AppendMissingPackages(packages, strings.Fields(FULL_ICU_PACKAGES)...)
+		if nodeAtLaunch {
+			runPackages = utils.AppendMissingPackages(runPackages, strings.Fields(FULL_ICU_PACKAGES)...)
+		}
+	}
+
+	packages = utils.GetVersionedNodejsPackages(ubiDistro, nodeMajorVersion, packages)
+	runPackages = utils.GetVersionedNodejsPackages(ubiDistro, nodeMajorVersion, runPackages)
+
+	// The build image is not probed when a module profile is requested, as the profile is always installed
+	var installedNodeVersion string
+	if nodejsProfile == "" {
+		installedNodeVersion = utils.GetInstalledNodeVersion(buildImage.NodeBinary)
+	}
+	nodePreinstalled := utils.IsNodeMajorVersionInstalled(installedNodeVersion, nodeMajorVersion)
+	if nodePreinstalled {
+		packages = utils.GetMissingPackages(packages, utils.GetInstalledPackages(buildImage.RpmBinary))
+		logger.Process("Node.js %s is already installed on the build image", installedNodeVersion)
+		if len(packages) > 0 {
+			logger.Subprocess("Installing the missing packages: %s", strings.Join(packages, " "))
+		}
+	}
+
+	return packageSelection{
+		Packages:         packages,
+		RunPackages:      runPackages,
+		NativePackages:   lockfileDependencies.NativePackages,
+		Profile:          nodejsProfile,
+		ModuleStream:     nodejsModuleStream,
+		NodePreinstalled: nodePreinstalled,
+		NodejsHeaders:    nodejsHeaders,
+		FIPS:             fipsEnabled,
+		FullICU:          fullIcuEnabled,
+	}, nil
+}
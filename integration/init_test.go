@@ -93,6 +93,7 @@ func TestIntegration(t *testing.T) {
 
 	suite := spec.New("Integration", spec.Report(report.Terminal{}), spec.Parallel())
 	suite("FetchRunImageFromEnv", testFetchRunImageFromEnv)
+	suite("FullICU", testFullICU)
 	suite("OpenSSL", testOpenSSL)
 	suite("OptimizeMemory", testOptimizeMemory)
 	suite("ProjectPath", testProjectPath)
@@ -0,0 +1,23 @@
+const http = require('http')
+const port = process.env.PORT || 8080
+
+const date = new Date(Date.UTC(2024, 0, 15, 12, 0, 0))
+const locales = ['en-US', 'de-DE', 'fr-FR', 'ja-JP']
+
+const requestHandler = (request, response) => {
+    const formatted = locales.map((locale) => {
+        const formatter = new Intl.DateTimeFormat(locale, { dateStyle: 'full', timeZone: 'UTC' })
+        return `${locale}: ${formatter.format(date)}`
+    })
+    response.end(formatted.join('\n'))
+}
+
+const server = http.createServer(requestHandler)
+
+server.listen(port, (err) => {
+    if (err) {
+        return console.log('something bad happened', err)
+    }
+
+    console.log(`server is listening on ${port}`)
+})
@@ -0,0 +1,114 @@
+package utils
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Release calendar of the Node.js major versions, the odd ones never becoming LTS
+//
+//go:embed nodejs_releases.json
+var nodejsReleasesJson []byte
+
+// Policies selecting the Node.js version of the apps which do not request any
+var DEFAULT_VERSION_POLICIES = []string{"builder-default", "latest", "latest-lts", "oldest-supported"}
+
+type NodejsRelease struct {
+	LTS       string `json:"lts"`
+	EndOfLife string `json:"end_of_life"`
+}
+
+// IsLTS tells whether the release is an active or maintenance LTS at the given date.
+func (release NodejsRelease) IsLTS(date time.Time) bool {
+	return release.LTS != "" && release.LTS <= date.Format(time.DateOnly) && release.IsSupported(date)
+}
+
+// IsSupported tells whether the release has not reached its end of life at the given date.
+func (release NodejsRelease) IsSupported(date time.Time) bool {
+	return release.EndOfLife != "" && date.Format(time.DateOnly) < release.EndOfLife
+}
+
+// GetNodejsReleases returns the embedded release calendar, keyed by major version.
+func GetNodejsReleases() (map[string]NodejsRelease, error) {
+	releases := map[string]NodejsRelease{}
+	if err := json.Unmarshal(nodejsReleasesJson, &releases); err != nil {
+		return nil, err
+	}
+
+	return releases, nil
+}
+
+// NoMatchingDefaultVersionError tells that none of the offered versions matches
+// a default version policy at a given date, which happens when the release
+// calendar is outdated.
+type NoMatchingDefaultVersionError struct {
+	Policy          string
+	Date            time.Time
+	OfferedVersions []string
+}
+
+func (err NoMatchingDefaultVersionError) Error() string {
+	return fmt.Sprintf("no node.js version matches the %s default version policy on %s, offered versions are: %s", err.Policy, err.Date.Format(time.DateOnly), strings.Join(err.OfferedVersions, ", "))
+}
+
+// GetDefaultNodeVersionByPolicy selects the default Node.js version among the
+// offered stacks. Versions missing from the release calendar are neither LTS
+// nor supported.
+func GetDefaultNodeVersionByPolicy(stacks []StackImages, policy string, date time.Time) (string, error) {
+	if policy == "" || policy == "builder-default" {
+		return GetDefaultNodeVersion(stacks)
+	}
+
+	releases, err := GetNodejsReleases()
+	if err != nil {
+		return "", err
+	}
+
+	var nodeVersions []int
+	for _, stack := range stacks {
+		nodeVersion, err := strconv.Atoi(stack.NodeVersion)
+		if err != nil {
+			return "", err
+		}
+		if !slices.Contains(nodeVersions, nodeVersion) {
+			nodeVersions = append(nodeVersions, nodeVersion)
+		}
+	}
+	slices.Sort(nodeVersions)
+
+	var candidates []int
+	switch policy {
+	case "latest":
+		candidates = slices.Clone(nodeVersions)
+		slices.Reverse(candidates)
+	case "latest-lts":
+		for _, nodeVersion := range slices.Backward(nodeVersions) {
+			if releases[strconv.Itoa(nodeVersion)].IsLTS(date) {
+				candidates = append(candidates, nodeVersion)
+			}
+		}
+	case "oldest-supported":
+		for _, nodeVersion := range nodeVersions {
+			if releases[strconv.Itoa(nodeVersion)].IsSupported(date) {
+				candidates = append(candidates, nodeVersion)
+			}
+		}
+	default:
+		return "", fmt.Errorf("invalid default version policy %q, supported policies are: %s", policy, strings.Join(DEFAULT_VERSION_POLICIES, ", "))
+	}
+
+	if len(candidates) == 0 {
+		var offeredVersions []string
+		for _, nodeVersion := range nodeVersions {
+			offeredVersions = append(offeredVersions, strconv.Itoa(nodeVersion))
+		}
+		return "", NoMatchingDefaultVersionError{Policy: policy, Date: date, OfferedVersions: offeredVersions}
+	}
+
+	return strconv.Itoa(candidates[0]), nil
+}
@@ -0,0 +1,59 @@
+package utils_test
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"github.com/paketo-buildpacks/ubi-nodejs-extension/internal/utils"
+	"github.com/sclevine/spec"
+)
+
+func testGetDefaultNodeVersionByPolicy(t *testing.T, context spec.G, it spec.S) {
+
+	var (
+		Expect = NewWithT(t).Expect
+		stacks = []utils.StackImages{
+			{Name: "nodejs-18", NodeVersion: "18"},
+			{Name: "nodejs-20", NodeVersion: "20", IsDefaultRunImage: true},
+			{Name: "nodejs-22", NodeVersion: "22"},
+			{Name: "nodejs-22-minimal", NodeVersion: "22", Variant: "minimal"},
+			{Name: "nodejs-23", NodeVersion: "23"},
+		}
+		date = time.Date(2025, time.March, 1, 0, 0, 0, 0, time.UTC)
+	)
+
+	it("It should return the default of the builder", func() {
+		Expect(utils.GetDefaultNodeVersionByPolicy(stacks, "", date)).To(Equal("20"))
+		Expect(utils.GetDefaultNodeVersionByPolicy(stacks, "builder-default", date)).To(Equal("20"))
+	})
+
+	it("It should return the latest version", func() {
+		Expect(utils.GetDefaultNodeVersionByPolicy(stacks, "latest", date)).To(Equal("23"))
+	})
+
+	it("It should return the latest LTS version", func() {
+		Expect(utils.GetDefaultNodeVersionByPolicy(stacks, "latest-lts", date)).To(Equal("22"))
+		Expect(utils.GetDefaultNodeVersionByPolicy(stacks[:2], "latest-lts", date)).To(Equal("20"))
+	})
+
+	it("It should return the oldest supported version", func() {
+		Expect(utils.GetDefaultNodeVersionByPolicy(stacks, "oldest-supported", date)).To(Equal("18"))
+		Expect(utils.GetDefaultNodeVersionByPolicy(stacks, "oldest-supported", time.Date(2025, time.May, 1, 0, 0, 0, 0, time.UTC))).To(Equal("20"))
+	})
+
+	it("It should fail when no version matches the policy", func() {
+		_, err := utils.GetDefaultNodeVersionByPolicy(stacks[:2], "latest-lts", time.Date(2026, time.June, 1, 0, 0, 0, 0, time.UTC))
+		Expect(err).To(MatchError("no node.js version matches the latest-lts default version policy on 2026-06-01, offered versions are: 18, 20"))
+	})
+
+	it("It should consider the versions missing from the release calendar as unsupported", func() {
+		_, err := utils.GetDefaultNodeVersionByPolicy([]utils.StackImages{{Name: "nodejs-99", NodeVersion: "99"}}, "oldest-supported", date)
+		Expect(err).To(MatchError(ContainSubstring("no node.js version matches the oldest-supported default version policy")))
+	})
+
+	it("It should fail on an unknown policy", func() {
+		_, err := utils.GetDefaultNodeVersionByPolicy(stacks, "newest", date)
+		Expect(err).To(MatchError(`invalid default version policy "newest", supported policies are: builder-default, latest, latest-lts, oldest-supported`))
+	})
+}
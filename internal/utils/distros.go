@@ -0,0 +1,109 @@
+package utils
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/paketo-buildpacks/ubi-nodejs-extension/constants"
+	"github.com/paketo-buildpacks/ubi-nodejs-extension/structs"
+)
+
+// GetTargetDistro returns the distro of the build image. The CNB_TARGET_DISTRO_*
+// variables set by the lifecycle take precedence over the os-release file.
+func GetTargetDistro(osReleasePath string) structs.Distro {
+	distro := structs.Distro{
+		Name:    os.Getenv("CNB_TARGET_DISTRO_NAME"),
+		Version: os.Getenv("CNB_TARGET_DISTRO_VERSION"),
+	}
+	if distro.Name != "" && distro.Version != "" {
+		return distro
+	}
+
+	file, err := os.Open(osReleasePath)
+	if err != nil {
+		return distro
+	}
+	defer file.Close()
+
+	osRelease := map[string]string{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		key, value, found := strings.Cut(scanner.Text(), "=")
+		if found {
+			osRelease[key] = strings.Trim(value, `"'`)
+		}
+	}
+
+	if distro.Name == "" {
+		distro.Name = osRelease["ID"]
+	}
+	if distro.Version == "" {
+		distro.Version = osRelease["VERSION_ID"]
+	}
+
+	return distro
+}
+
+// GetDistroMajorVersion returns the major version of the distro, defaulting
+// to UBI 8 when it could not be detected.
+func GetDistroMajorVersion(distro structs.Distro) string {
+	majorVersion, _, _ := strings.Cut(distro.Version, ".")
+	if majorVersion == "" {
+		return constants.DEFAULT_DISTRO_VERSION
+	}
+
+	return majorVersion
+}
+
+// GetUbiDistro returns how Node.js is delivered on the given UBI major version.
+func GetUbiDistro(ubiDistros map[string]structs.UbiDistro, distroVersion string) (structs.UbiDistro, error) {
+	ubiDistro, found := ubiDistros[distroVersion]
+	if !found {
+		var supportedVersions []string
+		for version := range ubiDistros {
+			supportedVersions = append(supportedVersions, version)
+		}
+		slices.SortFunc(supportedVersions, func(a, b string) int {
+			versionA, _ := strconv.Atoi(a)
+			versionB, _ := strconv.Atoi(b)
+			return versionA - versionB
+		})
+		return structs.UbiDistro{}, fmt.Errorf("UBI %s is not supported, supported versions are: %s", distroVersion, strings.Join(supportedVersions, ", "))
+	}
+
+	return ubiDistro, nil
+}
+
+// IsNodejsModuleStream tells whether the Node.js major version is installed by
+// enabling its nodejs module stream rather than from plain packages.
+func IsNodejsModuleStream(ubiDistro structs.UbiDistro, nodeVersion uint64) bool {
+	return ubiDistro.ModuleStreams && nodeVersion != ubiDistro.DefaultNodeVersion
+}
+
+// GetVersionedNodejsPackages renames the nodejs packages to the versioned
+// packages (e.g. nodejs24-npm) shipped on distros without module streams for
+// the Node.js versions other than the default one.
+func GetVersionedNodejsPackages(ubiDistro structs.UbiDistro, nodeVersion uint64, packages []string) []string {
+	if ubiDistro.ModuleStreams || nodeVersion == ubiDistro.DefaultNodeVersion {
+		return packages
+	}
+
+	versionedPackages := []string{}
+	for _, pkg := range packages {
+		switch {
+		case pkg == "nodejs":
+			pkg = fmt.Sprintf("nodejs%d", nodeVersion)
+		case pkg == "npm":
+			pkg = fmt.Sprintf("nodejs%d-npm", nodeVersion)
+		case strings.HasPrefix(pkg, "nodejs-"):
+			pkg = fmt.Sprintf("nodejs%d-%s", nodeVersion, strings.TrimPrefix(pkg, "nodejs-"))
+		}
+		versionedPackages = append(versionedPackages, pkg)
+	}
+
+	return versionedPackages
+}
@@ -0,0 +1,127 @@
+package utils_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/paketo-buildpacks/ubi-nodejs-extension/internal/utils"
+	"github.com/paketo-buildpacks/ubi-nodejs-extension/structs"
+	"github.com/sclevine/spec"
+)
+
+func testGetTargetDistro(t *testing.T, context spec.G, it spec.S) {
+
+	var (
+		Expect        = NewWithT(t).Expect
+		osReleasePath string
+	)
+
+	it.Before(func() {
+		osReleasePath = filepath.Join(t.TempDir(), "os-release")
+		Expect(os.WriteFile(osReleasePath, []byte(`NAME="Red Hat Enterprise Linux"
+VERSION="9.4 (Plow)"
+ID="rhel"
+ID_LIKE="fedora"
+VERSION_ID="9.4"
+`), 0644)).To(Succeed())
+	})
+
+	context("When the CNB_TARGET_DISTRO_* variables are not set", func() {
+
+		it("It should read the distro from the os-release file", func() {
+			Expect(utils.GetTargetDistro(osReleasePath)).To(Equal(structs.Distro{Name: "rhel", Version: "9.4"}))
+		})
+
+		it("It should return an empty distro when the os-release file does not exist", func() {
+			Expect(utils.GetTargetDistro("/path/to/no/os-release")).To(Equal(structs.Distro{}))
+		})
+	})
+
+	context("When the CNB_TARGET_DISTRO_* variables are set", func() {
+
+		it("It should prefer them over the os-release file", func() {
+			t.Setenv("CNB_TARGET_DISTRO_NAME", "rhel")
+			t.Setenv("CNB_TARGET_DISTRO_VERSION", "10.0")
+
+			Expect(utils.GetTargetDistro(osReleasePath)).To(Equal(structs.Distro{Name: "rhel", Version: "10.0"}))
+		})
+	}, spec.Sequential())
+}
+
+func testGetDistroMajorVersion(t *testing.T, context spec.G, it spec.S) {
+
+	var (
+		Expect = NewWithT(t).Expect
+	)
+
+	it("It should return the major version of the distro", func() {
+		Expect(utils.GetDistroMajorVersion(structs.Distro{Name: "rhel", Version: "9.4"})).To(Equal("9"))
+		Expect(utils.GetDistroMajorVersion(structs.Distro{Name: "rhel", Version: "10"})).To(Equal("10"))
+	})
+
+	it("It should default to UBI 8 when the version is unknown", func() {
+		Expect(utils.GetDistroMajorVersion(structs.Distro{})).To(Equal("8"))
+	})
+}
+
+func testGetUbiDistro(t *testing.T, context spec.G, it spec.S) {
+
+	var (
+		Expect = NewWithT(t).Expect
+	)
+
+	ubiDistros := map[string]structs.UbiDistro{
+		"8":  {ModuleStreams: true},
+		"9":  {ModuleStreams: true, DefaultNodeVersion: 16},
+		"10": {DefaultNodeVersion: 22},
+	}
+
+	it("It should return the supported distro", func() {
+		ubiDistro, err := utils.GetUbiDistro(ubiDistros, "9")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ubiDistro).To(Equal(structs.UbiDistro{ModuleStreams: true, DefaultNodeVersion: 16}))
+	})
+
+	it("It should error listing the supported versions", func() {
+		_, err := utils.GetUbiDistro(ubiDistros, "7")
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(Equal("UBI 7 is not supported, supported versions are: 8, 9, 10"))
+	})
+}
+
+func testGetVersionedNodejsPackages(t *testing.T, context spec.G, it spec.S) {
+
+	var (
+		Expect = NewWithT(t).Expect
+	)
+
+	packages := []string{"make", "nodejs", "npm", "nodejs-devel", "which"}
+
+	context("When Node.js is delivered as module streams", func() {
+
+		it("It should keep the packages as they are", func() {
+			ubiDistro := structs.UbiDistro{ModuleStreams: true, DefaultNodeVersion: 16}
+
+			Expect(utils.IsNodejsModuleStream(ubiDistro, 20)).To(BeTrue())
+			Expect(utils.IsNodejsModuleStream(ubiDistro, 16)).To(BeFalse())
+			Expect(utils.GetVersionedNodejsPackages(ubiDistro, 20, packages)).To(Equal(packages))
+		})
+	})
+
+	context("When the distro has no module streams", func() {
+
+		ubiDistro := structs.UbiDistro{DefaultNodeVersion: 22}
+
+		it("It should keep the packages of the default Node.js version", func() {
+			Expect(utils.IsNodejsModuleStream(ubiDistro, 22)).To(BeFalse())
+			Expect(utils.GetVersionedNodejsPackages(ubiDistro, 22, packages)).To(Equal(packages))
+		})
+
+		it("It should use the versioned packages of the other Node.js versions", func() {
+			Expect(utils.IsNodejsModuleStream(ubiDistro, 24)).To(BeFalse())
+			Expect(utils.GetVersionedNodejsPackages(ubiDistro, 24, packages)).To(Equal([]string{"make", "nodejs24", "nodejs24-npm", "nodejs24-devel", "which"}))
+		})
+	})
+}
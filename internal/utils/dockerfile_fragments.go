@@ -0,0 +1,99 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/paketo-buildpacks/ubi-nodejs-extension/structs"
+)
+
+// Instructions an app can use on its Dockerfile fragments
+var ALLOWED_FRAGMENT_INSTRUCTIONS = []string{"ARG", "ENV", "LABEL", "RUN", "USER", "WORKDIR"}
+
+type DockerfileFragment struct {
+	Path, Content string
+}
+
+// GetDockerfileFragments returns the *.Dockerfile fragments of a directory of
+// the app, sorted by name so apps can order them with a numeric prefix.
+func GetDockerfileFragments(fragmentsDir string) ([]DockerfileFragment, error) {
+	paths, err := filepath.Glob(filepath.Join(fragmentsDir, "*.Dockerfile"))
+	if err != nil {
+		return nil, err
+	}
+	slices.Sort(paths)
+
+	var fragments []DockerfileFragment
+	for _, path := range paths {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the Dockerfile fragment %s: %w", path, err)
+		}
+		fragments = append(fragments, DockerfileFragment{Path: path, Content: string(content)})
+	}
+
+	return fragments, nil
+}
+
+// ValidateDockerfileFragment checks that a fragment only uses the allowed
+// instructions and, when it switches user, ends as the CNB user.
+func ValidateDockerfileFragment(fragment DockerfileFragment, duringBuildPermissions structs.DuringBuildPermissions) error {
+	instructions := getDockerfileInstructions(fragment.Content)
+	if len(instructions) == 0 {
+		return errors.New("fragment has no instruction")
+	}
+
+	for _, instruction := range instructions {
+		keyword, _ := splitDockerfileInstruction(instruction)
+		if keyword == "FROM" {
+			return errors.New("fragment can not use a FROM instruction")
+		}
+		if !slices.Contains(ALLOWED_FRAGMENT_INSTRUCTIONS, keyword) {
+			return fmt.Errorf("instruction %s is not allowed, allowed instructions are: %s", keyword, strings.Join(ALLOWED_FRAGMENT_INSTRUCTIONS, ", "))
+		}
+	}
+
+	if lastUser := getLastUser(instructions); lastUser != "" && !isCNBUser(lastUser, duringBuildPermissions) {
+		return fmt.Errorf("fragment must end as the CNB user %d:%d, not %s", duringBuildPermissions.CNB_USER_ID, duringBuildPermissions.CNB_GROUP_ID, lastUser)
+	}
+
+	return nil
+}
+
+// AppendDockerfileFragments appends the fragments to a rendered Dockerfile,
+// each one preceded by a comment naming it.
+func AppendDockerfileFragments(content string, fragments []DockerfileFragment, appDir string) string {
+	for _, fragment := range fragments {
+		name, err := filepath.Rel(appDir, fragment.Path)
+		if err != nil {
+			name = filepath.Base(fragment.Path)
+		}
+		content = fmt.Sprintf("%s\n\n# %s\n%s", strings.TrimRight(content, "\n"), name, strings.TrimSpace(fragment.Content))
+	}
+
+	return content
+}
+
+// LoadDockerfileFragments reads and validates the fragments of a directory of
+// the app, returning them along with their names relative to the app.
+func LoadDockerfileFragments(appDir string, fragmentsDir string, duringBuildPermissions structs.DuringBuildPermissions) ([]DockerfileFragment, []string, error) {
+	fragments, err := GetDockerfileFragments(filepath.Join(appDir, fragmentsDir))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var names []string
+	for _, fragment := range fragments {
+		name, _ := filepath.Rel(appDir, fragment.Path)
+		if err := ValidateDockerfileFragment(fragment, duringBuildPermissions); err != nil {
+			return nil, nil, fmt.Errorf("invalid Dockerfile fragment %s: %w", name, err)
+		}
+		names = append(names, name)
+	}
+
+	return fragments, names, nil
+}
@@ -0,0 +1,95 @@
+package utils_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/paketo-buildpacks/ubi-nodejs-extension/internal/utils"
+	"github.com/paketo-buildpacks/ubi-nodejs-extension/structs"
+	"github.com/sclevine/spec"
+)
+
+func testLoadDockerfileFragments(t *testing.T, context spec.G, it spec.S) {
+
+	var (
+		Expect                 = NewWithT(t).Expect
+		appDir                 string
+		fragmentsDir           string
+		duringBuildPermissions = structs.DuringBuildPermissions{CNB_USER_ID: 1002, CNB_GROUP_ID: 1000}
+	)
+
+	it.Before(func() {
+		appDir = t.TempDir()
+		fragmentsDir = filepath.Join(appDir, ".ubi", "build.Dockerfile.d")
+		Expect(os.MkdirAll(fragmentsDir, os.ModePerm)).To(Succeed())
+	})
+
+	context("When the app has no fragment", func() {
+
+		it("It should return no fragment", func() {
+			fragments, names, err := utils.LoadDockerfileFragments(t.TempDir(), ".ubi/build.Dockerfile.d", duringBuildPermissions)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fragments).To(BeEmpty())
+			Expect(names).To(BeEmpty())
+		})
+	})
+
+	context("When the app has valid fragments", func() {
+
+		it.Before(func() {
+			Expect(os.WriteFile(filepath.Join(fragmentsDir, "20-config.Dockerfile"), []byte("USER root\nRUN echo 'max_connections=10' > /etc/app.conf\nUSER 1002:1000\n"), 0644)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(fragmentsDir, "10-env.Dockerfile"), []byte("ENV APP_MODE=production\n"), 0644)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(fragmentsDir, "README.md"), []byte("not a fragment"), 0644)).To(Succeed())
+		})
+
+		it("It should load them sorted by name and append them", func() {
+			fragments, names, err := utils.LoadDockerfileFragments(appDir, ".ubi/build.Dockerfile.d", duringBuildPermissions)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(names).To(Equal([]string{".ubi/build.Dockerfile.d/10-env.Dockerfile", ".ubi/build.Dockerfile.d/20-config.Dockerfile"}))
+
+			Expect(utils.AppendDockerfileFragments("FROM ${base_image}\nUSER 1002:1000\n", fragments, appDir)).To(Equal(`FROM ${base_image}
+USER 1002:1000
+
+# .ubi/build.Dockerfile.d/10-env.Dockerfile
+ENV APP_MODE=production
+
+# .ubi/build.Dockerfile.d/20-config.Dockerfile
+USER root
+RUN echo 'max_connections=10' > /etc/app.conf
+USER 1002:1000`))
+		})
+	})
+
+	context("When the app has fragments breaking the policy", func() {
+
+		it("It should reject FROM instructions", func() {
+			Expect(os.WriteFile(filepath.Join(fragmentsDir, "base.Dockerfile"), []byte("FROM registry.example.com/other\n"), 0644)).To(Succeed())
+
+			_, _, err := utils.LoadDockerfileFragments(appDir, ".ubi/build.Dockerfile.d", duringBuildPermissions)
+			Expect(err).To(MatchError("invalid Dockerfile fragment .ubi/build.Dockerfile.d/base.Dockerfile: fragment can not use a FROM instruction"))
+		})
+
+		it("It should reject the instructions which are not allowed", func() {
+			Expect(os.WriteFile(filepath.Join(fragmentsDir, "copy.Dockerfile"), []byte("# copy the config\ncopy app.conf /etc/app.conf\n"), 0644)).To(Succeed())
+
+			_, _, err := utils.LoadDockerfileFragments(appDir, ".ubi/build.Dockerfile.d", duringBuildPermissions)
+			Expect(err).To(MatchError("invalid Dockerfile fragment .ubi/build.Dockerfile.d/copy.Dockerfile: instruction COPY is not allowed, allowed instructions are: ARG, ENV, LABEL, RUN, USER, WORKDIR"))
+		})
+
+		it("It should reject fragments not ending as the CNB user", func() {
+			Expect(os.WriteFile(filepath.Join(fragmentsDir, "root.Dockerfile"), []byte("USER root\nRUN \\\n  microdnf install -y vim\n"), 0644)).To(Succeed())
+
+			_, _, err := utils.LoadDockerfileFragments(appDir, ".ubi/build.Dockerfile.d", duringBuildPermissions)
+			Expect(err).To(MatchError("invalid Dockerfile fragment .ubi/build.Dockerfile.d/root.Dockerfile: fragment must end as the CNB user 1002:1000, not root"))
+		})
+
+		it("It should reject empty fragments", func() {
+			Expect(os.WriteFile(filepath.Join(fragmentsDir, "empty.Dockerfile"), []byte("# nothing yet\n"), 0644)).To(Succeed())
+
+			_, _, err := utils.LoadDockerfileFragments(appDir, ".ubi/build.Dockerfile.d", duringBuildPermissions)
+			Expect(err).To(MatchError("invalid Dockerfile fragment .ubi/build.Dockerfile.d/empty.Dockerfile: fragment has no instruction"))
+		})
+	})
+}
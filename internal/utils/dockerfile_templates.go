@@ -0,0 +1,176 @@
+package utils
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/paketo-buildpacks/ubi-nodejs-extension/structs"
+)
+
+// DockerfileTemplates are the templates the build and run Dockerfiles are
+// rendered from, along with where they have been read from.
+type DockerfileTemplates struct {
+	Build, BuildSource string
+	Run, RunSource     string
+}
+
+// GetDockerfileTemplates returns the Dockerfile templates the builder provides
+// on the templates directory, falling back to the embedded ones. They are not
+// read from BP_* environment variables, which are set by the app.
+func GetDockerfileTemplates(templatesDir string) (DockerfileTemplates, error) {
+	build, buildSource, err := readDockerfileTemplate(filepath.Join(templatesDir, "build.Dockerfile"), buildDockerfileTemplate)
+	if err != nil {
+		return DockerfileTemplates{}, err
+	}
+
+	run, runSource, err := readDockerfileTemplate(filepath.Join(templatesDir, "run.Dockerfile"), runDockerfileTemplate)
+	if err != nil {
+		return DockerfileTemplates{}, err
+	}
+
+	return DockerfileTemplates{
+		Build:       build,
+		BuildSource: buildSource,
+		Run:         run,
+		RunSource:   runSource,
+	}, nil
+}
+
+// RenderBuildDockerfile renders the build Dockerfile template, checks it and
+// appends the build Dockerfile fragments of the app.
+func RenderBuildDockerfile(templates DockerfileTemplates, buildProps structs.BuildDockerfileProps, fragments []DockerfileFragment, appDir string, duringBuildPermissions structs.DuringBuildPermissions) (string, error) {
+	content, err := GenerateBuildDockerfileFromTemplate(templates.Build, buildProps)
+	if err != nil {
+		return "", fmt.Errorf("failed to render the build Dockerfile template %s: %w", templates.BuildSource, err)
+	}
+
+	err = ValidateBuildDockerfile(content, duringBuildPermissions)
+	if err != nil {
+		return "", fmt.Errorf("invalid build Dockerfile template %s: %w", templates.BuildSource, err)
+	}
+
+	return AppendDockerfileFragments(content, fragments, appDir), nil
+}
+
+// RenderRunDockerfile renders the run Dockerfile template, checks it and
+// appends the run Dockerfile fragments of the app.
+func RenderRunDockerfile(templates DockerfileTemplates, runProps structs.RunDockerfileProps, fragments []DockerfileFragment, appDir string, duringBuildPermissions structs.DuringBuildPermissions) (string, error) {
+	content, err := GenerateRunDockerfileFromTemplate(templates.Run, runProps)
+	if err != nil {
+		return "", fmt.Errorf("failed to render the run Dockerfile template %s: %w", templates.RunSource, err)
+	}
+
+	err = ValidateRunDockerfile(content, duringBuildPermissions)
+	if err != nil {
+		return "", fmt.Errorf("invalid run Dockerfile template %s: %w", templates.RunSource, err)
+	}
+
+	return AppendDockerfileFragments(content, fragments, appDir), nil
+}
+
+func readDockerfileTemplate(path string, embeddedTemplate string) (string, string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return embeddedTemplate, "embedded", nil
+		}
+		return "", "", fmt.Errorf("failed to read the Dockerfile template %s: %w", path, err)
+	}
+
+	return string(content), path, nil
+}
+
+// ValidateBuildDockerfile checks that a rendered build Dockerfile switches back
+// to the CNB user, as the build process must not run as root.
+func ValidateBuildDockerfile(content string, duringBuildPermissions structs.DuringBuildPermissions) error {
+	instructions := getDockerfileInstructions(content)
+
+	lastUser := getLastUser(instructions)
+	if lastUser == "" {
+		return errors.New("build Dockerfile does not switch back to the CNB user with a USER instruction")
+	}
+	if !isCNBUser(lastUser, duringBuildPermissions) {
+		return fmt.Errorf("build Dockerfile must end as the CNB user %d:%d, not %s", duringBuildPermissions.CNB_USER_ID, duringBuildPermissions.CNB_GROUP_ID, lastUser)
+	}
+
+	return nil
+}
+
+// ValidateRunDockerfile checks that a rendered run Dockerfile is based on a
+// run image and, when it switches user, ends as the CNB user.
+func ValidateRunDockerfile(content string, duringBuildPermissions structs.DuringBuildPermissions) error {
+	instructions := getDockerfileInstructions(content)
+
+	var firstInstruction string
+	for _, instruction := range instructions {
+		if keyword, _ := splitDockerfileInstruction(instruction); keyword != "ARG" {
+			firstInstruction = instruction
+			break
+		}
+	}
+	if keyword, _ := splitDockerfileInstruction(firstInstruction); keyword != "FROM" {
+		return errors.New("run Dockerfile must start with a FROM instruction")
+	}
+
+	if lastUser := getLastUser(instructions); lastUser != "" && !isCNBUser(lastUser, duringBuildPermissions) {
+		return fmt.Errorf("run Dockerfile must end as the CNB user %d:%d, not %s", duringBuildPermissions.CNB_USER_ID, duringBuildPermissions.CNB_GROUP_ID, lastUser)
+	}
+
+	return nil
+}
+
+// getDockerfileInstructions returns the instructions of a Dockerfile, joining
+// the continuation lines and skipping the comments.
+func getDockerfileInstructions(content string) []string {
+	var instructions []string
+	var current strings.Builder
+
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if current.Len() == 0 && (line == "" || strings.HasPrefix(line, "#")) {
+			continue
+		}
+
+		if strings.HasSuffix(line, "\\") {
+			current.WriteString(strings.TrimSuffix(line, "\\"))
+			current.WriteString(" ")
+			continue
+		}
+
+		current.WriteString(line)
+		instructions = append(instructions, current.String())
+		current.Reset()
+	}
+
+	if current.Len() > 0 {
+		instructions = append(instructions, current.String())
+	}
+
+	return instructions
+}
+
+func splitDockerfileInstruction(instruction string) (string, string) {
+	keyword, arguments, _ := strings.Cut(instruction, " ")
+	return strings.ToUpper(keyword), strings.TrimSpace(arguments)
+}
+
+func getLastUser(instructions []string) string {
+	var lastUser string
+	for _, instruction := range instructions {
+		if keyword, arguments := splitDockerfileInstruction(instruction); keyword == "USER" {
+			lastUser = arguments
+		}
+	}
+
+	return lastUser
+}
+
+func isCNBUser(user string, duringBuildPermissions structs.DuringBuildPermissions) bool {
+	return user == fmt.Sprintf("%d:%d", duringBuildPermissions.CNB_USER_ID, duringBuildPermissions.CNB_GROUP_ID) ||
+		user == fmt.Sprintf("%d", duringBuildPermissions.CNB_USER_ID)
+}
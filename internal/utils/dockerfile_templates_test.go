@@ -0,0 +1,121 @@
+package utils_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/paketo-buildpacks/ubi-nodejs-extension/internal/utils"
+	"github.com/paketo-buildpacks/ubi-nodejs-extension/structs"
+	"github.com/sclevine/spec"
+)
+
+func testGetDockerfileTemplates(t *testing.T, context spec.G, it spec.S) {
+
+	var (
+		Expect       = NewWithT(t).Expect
+		templatesDir string
+	)
+
+	it.Before(func() {
+		templatesDir = t.TempDir()
+	})
+
+	context("When no template is provided", func() {
+
+		it("It should fall back to the embedded templates", func() {
+			dockerfileTemplates, err := utils.GetDockerfileTemplates(filepath.Join(templatesDir, "missing"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(dockerfileTemplates.BuildSource).To(Equal("embedded"))
+			Expect(dockerfileTemplates.RunSource).To(Equal("embedded"))
+			Expect(dockerfileTemplates.Build).To(HavePrefix("ARG base_image\nFROM ${base_image}"))
+			Expect(dockerfileTemplates.Run).To(HavePrefix("FROM {{.Source}}"))
+		})
+	})
+
+	context("When templates are provided", func() {
+
+		it.Before(func() {
+			Expect(os.WriteFile(filepath.Join(templatesDir, "build.Dockerfile"), []byte("build template from the builder"), 0644)).To(Succeed())
+		})
+
+		it("It should read the templates of the templates directory", func() {
+			dockerfileTemplates, err := utils.GetDockerfileTemplates(templatesDir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(dockerfileTemplates.Build).To(Equal("build template from the builder"))
+			Expect(dockerfileTemplates.BuildSource).To(Equal(filepath.Join(templatesDir, "build.Dockerfile")))
+			Expect(dockerfileTemplates.RunSource).To(Equal("embedded"))
+		})
+
+		it("It should ignore the templates set by the environment of the app", func() {
+			runTemplatePath := filepath.Join(t.TempDir(), "run.Dockerfile")
+			Expect(os.WriteFile(runTemplatePath, []byte("run template from the app"), 0644)).To(Succeed())
+			t.Setenv("BP_UBI_RUN_DOCKERFILE_TEMPLATE", runTemplatePath)
+			t.Setenv("BP_UBI_BUILD_DOCKERFILE_TEMPLATE", runTemplatePath)
+
+			dockerfileTemplates, err := utils.GetDockerfileTemplates(templatesDir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(dockerfileTemplates.BuildSource).To(Equal(filepath.Join(templatesDir, "build.Dockerfile")))
+			Expect(dockerfileTemplates.RunSource).To(Equal("embedded"))
+		})
+	}, spec.Sequential())
+}
+
+func testValidateDockerfiles(t *testing.T, context spec.G, it spec.S) {
+
+	var (
+		Expect                 = NewWithT(t).Expect
+		duringBuildPermissions = structs.DuringBuildPermissions{CNB_USER_ID: 1002, CNB_GROUP_ID: 1000}
+	)
+
+	context("When the Dockerfiles are rendered from the embedded templates", func() {
+
+		it("It should accept them", func() {
+			buildDockerfile, err := utils.GenerateBuildDockerfile(structs.BuildDockerfileProps{
+				NODEJS_VERSION: 20,
+				CNB_USER_ID:    1002,
+				CNB_GROUP_ID:   1000,
+				CNB_STACK_ID:   "io.buildpacks.stacks.ubi8",
+				PACKAGES:       "nodejs npm",
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(utils.ValidateBuildDockerfile(buildDockerfile, duringBuildPermissions)).To(Succeed())
+
+			runDockerfile, err := utils.GenerateRunDockerfile(structs.RunDockerfileProps{
+				Source:       "paketocommunity/run-nodejs-20-ubi-base",
+				CNB_USER_ID:  1002,
+				CNB_GROUP_ID: 1000,
+				PACKAGES:     "libpq",
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(utils.ValidateRunDockerfile(runDockerfile, duringBuildPermissions)).To(Succeed())
+		})
+	})
+
+	context("When the build Dockerfile does not end as the CNB user", func() {
+
+		it("It should error when no USER instruction is found", func() {
+			err := utils.ValidateBuildDockerfile("ARG base_image\nFROM ${base_image}\nRUN microdnf install -y nodejs\n", duringBuildPermissions)
+			Expect(err).To(MatchError("build Dockerfile does not switch back to the CNB user with a USER instruction"))
+		})
+
+		it("It should error when the last USER is not the CNB user", func() {
+			err := utils.ValidateBuildDockerfile("FROM ${base_image}\nUSER 1002:1000\n# switching to root\nuser root\nRUN echo \\\n  done\n", duringBuildPermissions)
+			Expect(err).To(MatchError("build Dockerfile must end as the CNB user 1002:1000, not root"))
+		})
+	})
+
+	context("When the run Dockerfile is not valid", func() {
+
+		it("It should error when it does not start with FROM", func() {
+			err := utils.ValidateRunDockerfile("# run image\nARG run_image\nLABEL a=b\nFROM ${run_image}\n", duringBuildPermissions)
+			Expect(err).To(MatchError("run Dockerfile must start with a FROM instruction"))
+		})
+
+		it("It should error when it ends as another user", func() {
+			err := utils.ValidateRunDockerfile("FROM registry.example.com/run\nUSER root\nRUN echo run\n", duringBuildPermissions)
+			Expect(err).To(MatchError("run Dockerfile must end as the CNB user 1002:1000, not root"))
+		})
+	})
+}
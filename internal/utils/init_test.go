@@ -11,11 +11,46 @@ func TestUnitUtils(t *testing.T) {
 	suite := spec.New("utils-ubi-nodejs-extension", spec.Report(report.Terminal{}))
 	suite("GenerateConfigTomlContentFromImagesJson", testGenerateConfigTomlContentFromImagesJson)
 	suite("GetDefaultNodeVersion", testGetDefaultNodeVersion)
+	suite("GetDefaultNodeVersionByPolicy", testGetDefaultNodeVersionByPolicy)
+	suite("GetOfferedNodeMajorVersions", testGetOfferedNodeMajorVersions)
+	suite("GetFallbackNodeMajorVersion", testGetFallbackNodeMajorVersion)
+	suite("GetVersionConflicts", testGetVersionConflicts)
+	suite("GetNodeVersionFileEntries", testGetNodeVersionFileEntries)
+	suite("GetWorkspaces", testGetWorkspaces)
+	suite("GetWorkspacesNodeMajorVersion", testGetWorkspacesNodeMajorVersion)
 	suite("CreateConfigTomlFileContent", testCreateConfigTomlFileContent)
+	suite("GetTargetStack", testGetTargetStack)
+	suite("IsNodeRequiredAtLaunch", testIsNodeRequiredAtLaunch)
+	suite("FilterStackImagesByPlatform", testFilterStackImagesByPlatform)
+	suite("FilterStackImagesByDistroVersion", testFilterStackImagesByDistroVersion)
 	suite("ParseImagesJsonFile", testParseImagesJsonFile)
 	suite("GetNodejsStackImages", testGetNodejsStackImages)
+	suite("ValidateImagesJson", testValidateImagesJson)
 	suite("GetDuringBuildPermissions", testGetDuringBuildPermissions)
 	suite("testGenerateBuildDockerfile", testGenerateBuildDockerfile)
 	suite("testGenerateRunDockerfile", testGenerateRunDockerfile)
+	suite("GetCACertificatesFromBindings", testGetCACertificatesFromBindings)
+	suite("GetBooleanEnv", testGetBooleanEnv)
+	suite("ReadLockfileDependencies", testReadLockfileDependencies)
+	suite("GetNativeModulesMapping", testGetNativeModulesMapping)
+	suite("GetNativeModulesSystemPackages", testGetNativeModulesSystemPackages)
+	suite("WriteGenerateReport", testWriteGenerateReport)
+	suite("GetTargetDistro", testGetTargetDistro)
+	suite("GetDistroMajorVersion", testGetDistroMajorVersion)
+	suite("GetUbiDistro", testGetUbiDistro)
+	suite("GetVersionedNodejsPackages", testGetVersionedNodejsPackages)
+	suite("DetectPackageManager", testDetectPackageManager)
+	suite("GetPackageManager", testGetPackageManager)
+	suite("SelectRunImage", testSelectRunImage)
+	suite("GetRunImageLabels", testGetRunImageLabels)
+	suite("GetDockerfileTemplates", testGetDockerfileTemplates)
+	suite("ValidateDockerfiles", testValidateDockerfiles)
+	suite("LoadDockerfileFragments", testLoadDockerfileFragments)
+	suite("ValidateDockerfileProps", testValidateDockerfileProps)
+	suite("GetInstalledNodeVersion", testGetInstalledNodeVersion)
+	suite("GetInstalledPackages", testGetInstalledPackages)
+	suite("GetRequestedNpmVersion", testGetRequestedNpmVersion)
+	suite("GetSatisfyingBundledNpmVersion", testGetSatisfyingBundledNpmVersion)
+	suite("ResolveNpmVersion", testResolveNpmVersion)
 	suite.Run(t)
 }
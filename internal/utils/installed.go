@@ -0,0 +1,65 @@
+package utils
+
+import (
+	"os/exec"
+	"slices"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+)
+
+// GetInstalledNodeVersion returns the version of Node.js already installed on
+// the build image, or an empty string when node can not be run.
+func GetInstalledNodeVersion(nodeBinary string) string {
+	if nodeBinary == "" {
+		return ""
+	}
+
+	output, err := exec.Command(nodeBinary, "--version").Output()
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimPrefix(strings.TrimSpace(string(output)), "v")
+}
+
+// GetInstalledPackages returns the names of the packages of the rpm database
+// of the build image.
+func GetInstalledPackages(rpmBinary string) []string {
+	if rpmBinary == "" {
+		return nil
+	}
+
+	output, err := exec.Command(rpmBinary, "-qa", "--queryformat", "%{NAME}\n").Output()
+	if err != nil {
+		return nil
+	}
+
+	packages := strings.Fields(string(output))
+	slices.Sort(packages)
+
+	return slices.Compact(packages)
+}
+
+// IsNodeMajorVersionInstalled tells whether the Node.js version installed on
+// the build image has the given major version.
+func IsNodeMajorVersionInstalled(installedNodeVersion string, nodeMajorVersion uint64) bool {
+	version, err := semver.NewVersion(installedNodeVersion)
+	if err != nil {
+		return false
+	}
+
+	return version.Major() == nodeMajorVersion
+}
+
+// GetMissingPackages returns the packages which are not installed yet.
+func GetMissingPackages(packages []string, installedPackages []string) []string {
+	missingPackages := []string{}
+	for _, pkg := range packages {
+		if !slices.Contains(installedPackages, pkg) {
+			missingPackages = append(missingPackages, pkg)
+		}
+	}
+
+	return missingPackages
+}
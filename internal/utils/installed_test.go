@@ -0,0 +1,66 @@
+package utils_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/paketo-buildpacks/ubi-nodejs-extension/internal/utils"
+	"github.com/sclevine/spec"
+)
+
+func testGetInstalledNodeVersion(t *testing.T, context spec.G, it spec.S) {
+
+	var (
+		Expect = NewWithT(t).Expect
+		binDir string
+	)
+
+	it.Before(func() {
+		binDir = t.TempDir()
+	})
+
+	it("It should return the version reported by node", func() {
+		Expect(os.WriteFile(filepath.Join(binDir, "node"), []byte("#!/bin/sh\necho v20.11.1\n"), 0755)).To(Succeed())
+
+		Expect(utils.GetInstalledNodeVersion(filepath.Join(binDir, "node"))).To(Equal("20.11.1"))
+	})
+
+	it("It should return an empty version when node is not installed", func() {
+		Expect(utils.GetInstalledNodeVersion(filepath.Join(binDir, "node"))).To(BeEmpty())
+	})
+
+	it("It should compare the major version", func() {
+		Expect(utils.IsNodeMajorVersionInstalled("20.11.1", 20)).To(BeTrue())
+		Expect(utils.IsNodeMajorVersionInstalled("18.19.0", 20)).To(BeFalse())
+		Expect(utils.IsNodeMajorVersionInstalled("", 20)).To(BeFalse())
+	})
+}
+
+func testGetInstalledPackages(t *testing.T, context spec.G, it spec.S) {
+
+	var (
+		Expect = NewWithT(t).Expect
+		binDir string
+	)
+
+	it.Before(func() {
+		binDir = t.TempDir()
+	})
+
+	it("It should return the packages of the rpm database", func() {
+		Expect(os.WriteFile(filepath.Join(binDir, "rpm"), []byte("#!/bin/sh\nprintf 'which\\nnodejs\\nnpm\\nnodejs\\n'\n"), 0755)).To(Succeed())
+
+		Expect(utils.GetInstalledPackages(filepath.Join(binDir, "rpm"))).To(Equal([]string{"nodejs", "npm", "which"}))
+	})
+
+	it("It should return no package when rpm is not available", func() {
+		Expect(utils.GetInstalledPackages(filepath.Join(binDir, "rpm"))).To(BeEmpty())
+	})
+
+	it("It should return the packages which are not installed yet", func() {
+		Expect(utils.GetMissingPackages([]string{"nodejs", "npm", "python3"}, []string{"nodejs", "npm", "which"})).To(Equal([]string{"python3"}))
+		Expect(utils.GetMissingPackages([]string{"nodejs"}, []string{"nodejs"})).To(Equal([]string{}))
+	})
+}
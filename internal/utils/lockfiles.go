@@ -0,0 +1,291 @@
+package utils
+
+import (
+	"bufio"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+//go:embed native_modules.json
+var nativeModulesMappingJson []byte
+
+// Node.js modules known to compile native code when they are installed
+var knownNativeModules = []string{
+	"argon2",
+	"bcrypt",
+	"better-sqlite3",
+	"bufferutil",
+	"canvas",
+	"cpu-features",
+	"node-pty",
+	"node-sass",
+	"re2",
+	"sharp",
+	"sqlite3",
+	"utf-8-validate",
+}
+
+type LockfileDependencies struct {
+	Lockfile       string
+	Packages       []string
+	NativePackages []string
+}
+
+type NativeModuleDependencies struct {
+	Build []string `json:"build"`
+	Run   []string `json:"run"`
+}
+
+type packageLockJsonDependency struct {
+	HasInstallScript bool                                 `json:"hasInstallScript"`
+	Dependencies     map[string]packageLockJsonDependency `json:"dependencies"`
+}
+
+type packageLockJson struct {
+	Packages     map[string]packageLockJsonDependency `json:"packages"`
+	Dependencies map[string]packageLockJsonDependency `json:"dependencies"`
+}
+
+// ReadLockfileDependencies lists the packages of the first lockfile found on the
+// project path and the ones among them which compile native code. An empty
+// Lockfile means that the project has no lockfile.
+func ReadLockfileDependencies(projectPath string) (LockfileDependencies, error) {
+	parsers := []struct {
+		lockfile string
+		parse    func(content []byte) (map[string]bool, error)
+	}{
+		{lockfile: "package-lock.json", parse: parsePackageLockJson},
+		{lockfile: "npm-shrinkwrap.json", parse: parsePackageLockJson},
+		{lockfile: "yarn.lock", parse: parseYarnLock},
+		{lockfile: "pnpm-lock.yaml", parse: parsePnpmLockYaml},
+	}
+
+	for _, parser := range parsers {
+		content, err := os.ReadFile(filepath.Join(projectPath, parser.lockfile))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return LockfileDependencies{}, err
+		}
+
+		packages, err := parser.parse(content)
+		if err != nil {
+			return LockfileDependencies{}, err
+		}
+
+		lockfileDependencies := LockfileDependencies{
+			Lockfile:       parser.lockfile,
+			Packages:       []string{},
+			NativePackages: []string{},
+		}
+
+		for _, packageName := range slices.Sorted(maps.Keys(packages)) {
+			lockfileDependencies.Packages = append(lockfileDependencies.Packages, packageName)
+
+			_, err := os.Stat(filepath.Join(projectPath, "node_modules", packageName, "binding.gyp"))
+			hasBindingGyp := err == nil
+
+			if packages[packageName] || hasBindingGyp || slices.Contains(knownNativeModules, packageName) {
+				lockfileDependencies.NativePackages = append(lockfileDependencies.NativePackages, packageName)
+			}
+		}
+
+		return lockfileDependencies, nil
+	}
+
+	return LockfileDependencies{}, nil
+}
+
+// GetNativeModulesMapping returns the system packages required by native
+// modules. The embedded mapping of well known native modules is included
+// unless it is skipped, the entries of the mapping file, if any, replace the
+// embedded ones for the same module.
+func GetNativeModulesMapping(mappingFilePath string, includeEmbedded bool) (map[string]NativeModuleDependencies, error) {
+	mapping := map[string]NativeModuleDependencies{}
+	if includeEmbedded {
+		err := json.Unmarshal(nativeModulesMappingJson, &mapping)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if mappingFilePath == "" {
+		return mapping, nil
+	}
+
+	content, err := os.ReadFile(mappingFilePath)
+	if err != nil {
+		return nil, err
+	}
+
+	overrides := map[string]NativeModuleDependencies{}
+	err = json.Unmarshal(content, &overrides)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse native modules mapping %s: %w", mappingFilePath, err)
+	}
+
+	for _, module := range slices.Sorted(maps.Keys(overrides)) {
+		if err := ValidatePackageNames(strings.Join(append(overrides[module].Build, overrides[module].Run...), " ")); err != nil {
+			return nil, fmt.Errorf("invalid system packages for %s on native modules mapping %s: %w", module, mappingFilePath, err)
+		}
+	}
+
+	maps.Copy(mapping, overrides)
+
+	return mapping, nil
+}
+
+// GetNativeModulesSystemPackages returns the build and run system packages
+// required by the given Node.js packages, along with the packages matched.
+func GetNativeModulesSystemPackages(mapping map[string]NativeModuleDependencies, packages []string) (buildPackages []string, runPackages []string, matchedPackages []string) {
+	buildPackages, runPackages, matchedPackages = []string{}, []string{}, []string{}
+
+	for _, packageName := range packages {
+		dependencies, found := mapping[packageName]
+		if !found {
+			continue
+		}
+
+		matchedPackages = append(matchedPackages, packageName)
+		buildPackages = AppendMissingPackages(buildPackages, dependencies.Build...)
+		runPackages = AppendMissingPackages(runPackages, dependencies.Run...)
+	}
+
+	return buildPackages, runPackages, matchedPackages
+}
+
+// AppendMissingPackages appends the packages which are not already part of the list.
+func AppendMissingPackages(packages []string, extraPackages ...string) []string {
+	for _, extraPackage := range extraPackages {
+		if !slices.Contains(packages, extraPackage) {
+			packages = append(packages, extraPackage)
+		}
+	}
+
+	return packages
+}
+
+// parsePackageLockJson supports both the "packages" section of lockfile
+// version 2 and 3 and the nested "dependencies" of lockfile version 1.
+func parsePackageLockJson(content []byte) (map[string]bool, error) {
+	var lockfile packageLockJson
+	err := json.Unmarshal(content, &lockfile)
+	if err != nil {
+		return nil, err
+	}
+
+	packages := map[string]bool{}
+	for path, dependency := range lockfile.Packages {
+		index := strings.LastIndex(path, "node_modules/")
+		if index == -1 {
+			continue
+		}
+		packageName := path[index+len("node_modules/"):]
+		packages[packageName] = packages[packageName] || dependency.HasInstallScript
+	}
+
+	var addDependencies func(dependencies map[string]packageLockJsonDependency)
+	addDependencies = func(dependencies map[string]packageLockJsonDependency) {
+		for packageName, dependency := range dependencies {
+			packages[packageName] = packages[packageName] || dependency.HasInstallScript
+			addDependencies(dependency.Dependencies)
+		}
+	}
+	addDependencies(lockfile.Dependencies)
+
+	return packages, nil
+}
+
+// parseYarnLock reads the package names from the entry headers of both
+// classic and berry lockfiles, eg. `"@scope/name@^1.0.0", "@scope/name@^1.1.0":`
+func parseYarnLock(content []byte) (map[string]bool, error) {
+	packages := map[string]bool{}
+
+	scanner := bufio.NewScanner(strings.NewReader(string(content)))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" || strings.HasPrefix(line, " ") || strings.HasPrefix(line, "#") || !strings.HasSuffix(line, ":") {
+			continue
+		}
+
+		descriptor := strings.Trim(strings.Split(strings.TrimSuffix(line, ":"), ",")[0], `"`)
+		if descriptor == "__metadata" {
+			continue
+		}
+
+		if packageName := packageNameFromDescriptor(descriptor); packageName != "" {
+			packages[packageName] = false
+		}
+	}
+
+	return packages, scanner.Err()
+}
+
+// parsePnpmLockYaml reads the keys of the "packages" section, eg.
+// `/name/1.0.0:`, `/name@1.0.0:` or `name@1.0.0(peer@2.0.0):` depending on the
+// lockfile version, and flags the ones with `requiresBuild: true`.
+func parsePnpmLockYaml(content []byte) (map[string]bool, error) {
+	packages := map[string]bool{}
+
+	var inPackagesSection bool
+	var currentPackage string
+	scanner := bufio.NewScanner(strings.NewReader(string(content)))
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		if !strings.HasPrefix(line, " ") && line != "" {
+			inPackagesSection = line == "packages:"
+			currentPackage = ""
+			continue
+		}
+
+		if !inPackagesSection {
+			continue
+		}
+
+		if strings.HasPrefix(line, "  ") && !strings.HasPrefix(line, "   ") && strings.HasSuffix(line, ":") {
+			key := strings.Trim(strings.TrimSpace(strings.TrimSuffix(line, ":")), `'"`)
+			key = strings.TrimPrefix(strings.Split(key, "(")[0], "/")
+
+			currentPackage = packageNameFromDescriptor(key)
+			if currentPackage == "" {
+				if index := strings.LastIndex(key, "/"); index > 0 {
+					currentPackage = key[:index]
+				}
+			}
+
+			if _, found := packages[currentPackage]; currentPackage != "" && !found {
+				packages[currentPackage] = false
+			}
+			continue
+		}
+
+		if currentPackage != "" && strings.TrimSpace(line) == "requiresBuild: true" {
+			packages[currentPackage] = true
+		}
+	}
+
+	return packages, scanner.Err()
+}
+
+// packageNameFromDescriptor strips the version range from a package
+// descriptor, eg. `@scope/name@npm:^1.0.0` returns `@scope/name`.
+func packageNameFromDescriptor(descriptor string) string {
+	if len(descriptor) < 2 {
+		return ""
+	}
+
+	index := strings.Index(descriptor[1:], "@")
+	if index == -1 {
+		return ""
+	}
+
+	return descriptor[:index+1]
+}
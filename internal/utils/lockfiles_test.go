@@ -0,0 +1,260 @@
+package utils_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/paketo-buildpacks/ubi-nodejs-extension/internal/utils"
+	"github.com/sclevine/spec"
+)
+
+func testReadLockfileDependencies(t *testing.T, context spec.G, it spec.S) {
+
+	var (
+		Expect      = NewWithT(t).Expect
+		projectPath string
+	)
+
+	it.Before(func() {
+		projectPath = t.TempDir()
+	})
+
+	context("When the project has no lockfile", func() {
+
+		it("It should return no lockfile", func() {
+			lockfileDependencies, err := utils.ReadLockfileDependencies(projectPath)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(lockfileDependencies).To(Equal(utils.LockfileDependencies{}))
+		})
+	})
+
+	context("When the project has a package-lock.json file", func() {
+
+		it("It should read the packages of lockfile version 3", func() {
+			Expect(os.WriteFile(filepath.Join(projectPath, "package-lock.json"), []byte(`{
+  "name": "app",
+  "lockfileVersion": 3,
+  "packages": {
+    "": { "name": "app" },
+    "node_modules/express": { "version": "4.18.2" },
+    "node_modules/@scope/addon": { "version": "1.0.0", "hasInstallScript": true },
+    "node_modules/express/node_modules/node-rdkafka": { "version": "3.0.1", "hasInstallScript": true }
+  }
+}`), 0600)).To(Succeed())
+
+			lockfileDependencies, err := utils.ReadLockfileDependencies(projectPath)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(lockfileDependencies).To(Equal(utils.LockfileDependencies{
+				Lockfile:       "package-lock.json",
+				Packages:       []string{"@scope/addon", "express", "node-rdkafka"},
+				NativePackages: []string{"@scope/addon", "node-rdkafka"},
+			}))
+		})
+
+		it("It should read the nested dependencies of lockfile version 1", func() {
+			Expect(os.WriteFile(filepath.Join(projectPath, "package-lock.json"), []byte(`{
+  "name": "app",
+  "lockfileVersion": 1,
+  "dependencies": {
+    "express": {
+      "version": "4.18.2",
+      "dependencies": {
+        "sharp": { "version": "0.32.0" }
+      }
+    }
+  }
+}`), 0600)).To(Succeed())
+
+			lockfileDependencies, err := utils.ReadLockfileDependencies(projectPath)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(lockfileDependencies).To(Equal(utils.LockfileDependencies{
+				Lockfile:       "package-lock.json",
+				Packages:       []string{"express", "sharp"},
+				NativePackages: []string{"sharp"},
+			}))
+		})
+
+		it("It should flag the installed packages which have a binding.gyp file", func() {
+			Expect(os.WriteFile(filepath.Join(projectPath, "package-lock.json"), []byte(`{
+  "lockfileVersion": 3,
+  "packages": {
+    "node_modules/my-addon": { "version": "1.0.0" }
+  }
+}`), 0600)).To(Succeed())
+			Expect(os.MkdirAll(filepath.Join(projectPath, "node_modules", "my-addon"), 0755)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(projectPath, "node_modules", "my-addon", "binding.gyp"), []byte("{}"), 0600)).To(Succeed())
+
+			lockfileDependencies, err := utils.ReadLockfileDependencies(projectPath)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(lockfileDependencies.NativePackages).To(Equal([]string{"my-addon"}))
+		})
+
+		it("It should error when the lockfile is not a valid json", func() {
+			Expect(os.WriteFile(filepath.Join(projectPath, "package-lock.json"), []byte(`not json`), 0600)).To(Succeed())
+
+			_, err := utils.ReadLockfileDependencies(projectPath)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("invalid character"))
+		})
+	})
+
+	context("When the project has a yarn.lock file", func() {
+
+		it("It should read the packages from the entry headers", func() {
+			Expect(os.WriteFile(filepath.Join(projectPath, "yarn.lock"), []byte(`# THIS IS AN AUTOGENERATED FILE. DO NOT EDIT THIS FILE DIRECTLY.
+# yarn lockfile v1
+
+
+"@scope/util@^1.0.0", "@scope/util@^1.1.0":
+  version "1.1.0"
+
+canvas@^2.11.0:
+  version "2.11.2"
+  dependencies:
+    nan "^2.17.0"
+
+"nan@npm:^2.17.0":
+  version: 2.17.0
+`), 0600)).To(Succeed())
+
+			lockfileDependencies, err := utils.ReadLockfileDependencies(projectPath)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(lockfileDependencies).To(Equal(utils.LockfileDependencies{
+				Lockfile:       "yarn.lock",
+				Packages:       []string{"@scope/util", "canvas", "nan"},
+				NativePackages: []string{"canvas"},
+			}))
+		})
+	})
+
+	context("When the project has a pnpm-lock.yaml file", func() {
+
+		it("It should read the packages and the ones requiring a build", func() {
+			Expect(os.WriteFile(filepath.Join(projectPath, "pnpm-lock.yaml"), []byte(`lockfileVersion: '6.0'
+
+dependencies:
+  express:
+    specifier: ^4.18.2
+    version: 4.18.2
+
+packages:
+
+  /@scope/addon@1.0.0:
+    resolution: {integrity: sha512-abc}
+    requiresBuild: true
+    dev: false
+
+  /express@4.18.2:
+    resolution: {integrity: sha512-def}
+    dev: false
+
+  /legacy/2.0.0:
+    resolution: {integrity: sha512-ghi}
+    dev: false
+
+  'ws@8.14.2(bufferutil@4.0.8)':
+    resolution: {integrity: sha512-jkl}
+`), 0600)).To(Succeed())
+
+			lockfileDependencies, err := utils.ReadLockfileDependencies(projectPath)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(lockfileDependencies).To(Equal(utils.LockfileDependencies{
+				Lockfile:       "pnpm-lock.yaml",
+				Packages:       []string{"@scope/addon", "express", "legacy", "ws"},
+				NativePackages: []string{"@scope/addon"},
+			}))
+		})
+	})
+}
+
+func testGetNativeModulesMapping(t *testing.T, context spec.G, it spec.S) {
+
+	var (
+		Expect = NewWithT(t).Expect
+	)
+
+	context("When no mapping file is given", func() {
+
+		it("It should return the embedded mapping when requested", func() {
+			mapping, err := utils.GetNativeModulesMapping("", true)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(mapping["pg-native"]).To(Equal(utils.NativeModuleDependencies{
+				Build: []string{"libpq-devel"},
+				Run:   []string{"libpq"},
+			}))
+		})
+
+		it("It should return an empty mapping when the embedded one is not requested", func() {
+			mapping, err := utils.GetNativeModulesMapping("", false)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(mapping).To(BeEmpty())
+		})
+	})
+
+	context("When a mapping file is given", func() {
+
+		it("It should replace the embedded entries with the ones of the file", func() {
+			mappingPath := filepath.Join(t.TempDir(), "mapping.json")
+			Expect(os.WriteFile(mappingPath, []byte(`{
+  "pg-native": { "build": ["postgresql-devel"], "run": ["postgresql-libs"] },
+  "my-addon": { "build": ["libfoo-devel"], "run": [] }
+}`), 0600)).To(Succeed())
+
+			mapping, err := utils.GetNativeModulesMapping(mappingPath, true)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(mapping["pg-native"]).To(Equal(utils.NativeModuleDependencies{
+				Build: []string{"postgresql-devel"},
+				Run:   []string{"postgresql-libs"},
+			}))
+			Expect(mapping["my-addon"]).To(Equal(utils.NativeModuleDependencies{
+				Build: []string{"libfoo-devel"},
+				Run:   []string{},
+			}))
+			Expect(mapping).To(HaveKey("canvas"))
+		})
+
+		it("It should only return the entries of the file when the embedded mapping is not requested", func() {
+			mappingPath := filepath.Join(t.TempDir(), "mapping.json")
+			Expect(os.WriteFile(mappingPath, []byte(`{ "my-addon": { "build": ["libfoo-devel"], "run": ["libfoo"] } }`), 0600)).To(Succeed())
+
+			mapping, err := utils.GetNativeModulesMapping(mappingPath, false)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(mapping).To(Equal(map[string]utils.NativeModuleDependencies{
+				"my-addon": {Build: []string{"libfoo-devel"}, Run: []string{"libfoo"}},
+			}))
+		})
+
+		it("It should error when the file is not a valid json", func() {
+			mappingPath := filepath.Join(t.TempDir(), "mapping.json")
+			Expect(os.WriteFile(mappingPath, []byte(`not json`), 0600)).To(Succeed())
+
+			_, err := utils.GetNativeModulesMapping(mappingPath, false)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("failed to parse native modules mapping"))
+		})
+	})
+}
+
+func testGetNativeModulesSystemPackages(t *testing.T, context spec.G, it spec.S) {
+
+	var (
+		Expect = NewWithT(t).Expect
+	)
+
+	context("When some packages are part of the mapping", func() {
+
+		it("It should return their system packages without duplicates", func() {
+			buildPackages, runPackages, matchedPackages := utils.GetNativeModulesSystemPackages(map[string]utils.NativeModuleDependencies{
+				"sqlite3":        {Build: []string{"sqlite-devel"}, Run: []string{"sqlite-libs"}},
+				"better-sqlite3": {Build: []string{"sqlite-devel"}, Run: []string{"sqlite-libs"}},
+				"canvas":         {Build: []string{"cairo-devel"}, Run: []string{"cairo"}},
+			}, []string{"better-sqlite3", "express", "sqlite3"})
+
+			Expect(buildPackages).To(Equal([]string{"sqlite-devel"}))
+			Expect(runPackages).To(Equal([]string{"sqlite-libs"}))
+			Expect(matchedPackages).To(Equal([]string{"better-sqlite3", "sqlite3"}))
+		})
+	})
+}
@@ -0,0 +1,308 @@
+package utils
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/paketo-buildpacks/packit/v2/scribe"
+)
+
+// Node.js major versions supported by each npm major version. The Node.js
+// module streams ship the latest minor version of a major version, so the
+// compatibility is checked against the major version only.
+//
+//go:embed npm_versions.json
+var npmVersionsJson []byte
+
+// npm versions bundled with the Node.js packages of each major version.
+//
+//go:embed bundled_npm_versions.json
+var bundledNpmVersionsJson []byte
+
+var versionRegexp = regexp.MustCompile(`\d+(\.\d+){0,2}`)
+
+type NpmInstallation struct {
+	// Version is the exact version of a tarball or the range resolved by the registry
+	Version string
+	// Package is the argument given to npm install, a tarball path or a npm@range spec
+	Package string
+	// Source is either "tarball" or "registry"
+	Source string
+}
+
+// NpmSelection is the npm version requested by the app and how it is
+// installed, nothing being installed when Installation is empty.
+type NpmSelection struct {
+	VersionSource string
+	Installation  NpmInstallation
+	// Registry is the registry set by BP_UBI_NPM_REGISTRY, empty when npm is installed from a tarball
+	Registry string
+}
+
+type packageJsonEngines struct {
+	Engines struct {
+		Npm string `json:"npm"`
+	} `json:"engines"`
+}
+
+// GetRequestedNpmVersion returns the npm version requested by BP_UBI_NPM_VERSION
+// or, when it is not set, by the engines.npm field of the package.json file.
+func GetRequestedNpmVersion(projectPath string) (version string, versionSource string, err error) {
+	if version := os.Getenv("BP_UBI_NPM_VERSION"); version != "" {
+		return version, "BP_UBI_NPM_VERSION", nil
+	}
+
+	content, err := os.ReadFile(filepath.Join(projectPath, "package.json"))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", "", nil
+	} else if err != nil {
+		return "", "", err
+	}
+
+	var packageJson packageJsonEngines
+	if err := json.Unmarshal(content, &packageJson); err != nil {
+		return "", "", fmt.Errorf("failed to parse package.json: %w", err)
+	}
+
+	if packageJson.Engines.Npm == "" {
+		return "", "", nil
+	}
+
+	return packageJson.Engines.Npm, "package.json", nil
+}
+
+// SelectNpmInstallation returns how the npm version requested by the app is
+// installed on the build image, keeping the npm bundled with Node.js when it
+// satisfies the requested range.
+func SelectNpmInstallation(logger scribe.Emitter, projectPath string, nodeMajorVersion uint64, tarballsDir string) (NpmSelection, error) {
+	npmVersion, npmVersionSource, err := GetRequestedNpmVersion(projectPath)
+	if err != nil {
+		return NpmSelection{}, err
+	}
+
+	npmRegistry := os.Getenv("BP_UBI_NPM_REGISTRY")
+	if err := ValidateNpmRegistry(npmRegistry); err != nil {
+		return NpmSelection{}, fmt.Errorf("invalid registry set by BP_UBI_NPM_REGISTRY: %w", err)
+	}
+
+	if npmVersion == "" {
+		return NpmSelection{Registry: npmRegistry}, nil
+	}
+
+	bundledNpmVersion, err := GetSatisfyingBundledNpmVersion(npmVersion, npmVersionSource, nodeMajorVersion)
+	if err != nil {
+		return NpmSelection{}, err
+	}
+
+	if bundledNpmVersion != "" {
+		logger.Process("Keeping npm %s bundled with Node.js %d as it satisfies %s requested by %s", bundledNpmVersion, nodeMajorVersion, npmVersion, npmVersionSource)
+		return NpmSelection{VersionSource: npmVersionSource, Registry: npmRegistry}, nil
+	}
+
+	npmInstallation, err := ResolveNpmVersion(npmVersion, npmVersionSource, nodeMajorVersion, tarballsDir)
+	if err != nil {
+		return NpmSelection{}, err
+	}
+
+	if npmInstallation.Source == "tarball" {
+		logger.Process("Installing npm %s requested by %s from the tarball of the builder", npmInstallation.Version, npmVersionSource)
+		logger.Subprocess(npmInstallation.Package)
+		// Tarballs are installed without reaching any registry
+		return NpmSelection{VersionSource: npmVersionSource, Installation: npmInstallation}, nil
+	}
+
+	logger.Process("Installing npm %s requested by %s from the registry", npmInstallation.Version, npmVersionSource)
+	if npmRegistry != "" {
+		logger.Subprocess("Using the registry %s set by BP_UBI_NPM_REGISTRY", npmRegistry)
+	}
+
+	return NpmSelection{VersionSource: npmVersionSource, Installation: npmInstallation, Registry: npmRegistry}, nil
+}
+
+// GetSatisfyingBundledNpmVersion returns the npm version bundled with the
+// Node.js packages of a major version when it satisfies the requested range,
+// or an empty string when it does not or is not known.
+func GetSatisfyingBundledNpmVersion(requestedVersion string, versionSource string, nodeMajorVersion uint64) (string, error) {
+	constraint, err := semver.NewConstraint(requestedVersion)
+	if err != nil {
+		return "", fmt.Errorf("invalid npm version %q requested by %s: %w", requestedVersion, versionSource, err)
+	}
+
+	bundledNpmVersions := map[string]string{}
+	if err := json.Unmarshal(bundledNpmVersionsJson, &bundledNpmVersions); err != nil {
+		return "", err
+	}
+
+	bundledNpmVersion, found := bundledNpmVersions[strconv.FormatUint(nodeMajorVersion, 10)]
+	if !found {
+		return "", nil
+	}
+
+	version, err := semver.StrictNewVersion(bundledNpmVersion)
+	if err != nil {
+		return "", err
+	}
+
+	if !constraint.Check(version) {
+		return "", nil
+	}
+
+	return bundledNpmVersion, nil
+}
+
+// ResolveNpmVersion picks the npm version to install for the requested range.
+// The tarballs bundled by the builder are preferred as they do not need any
+// network access, the registry being used when none of them matches.
+func ResolveNpmVersion(requestedVersion string, versionSource string, nodeMajorVersion uint64, tarballsDir string) (NpmInstallation, error) {
+	constraint, err := semver.NewConstraint(requestedVersion)
+	if err != nil {
+		return NpmInstallation{}, fmt.Errorf("invalid npm version %q requested by %s: %w", requestedVersion, versionSource, err)
+	}
+
+	npmVersions := map[string]string{}
+	if err := json.Unmarshal(npmVersionsJson, &npmVersions); err != nil {
+		return NpmInstallation{}, err
+	}
+
+	var npmMajorVersions []uint64
+	for major := range npmVersions {
+		npmMajorVersion, err := strconv.ParseUint(major, 10, 64)
+		if err != nil {
+			return NpmInstallation{}, err
+		}
+		npmMajorVersions = append(npmMajorVersions, npmMajorVersion)
+	}
+	slices.Sort(npmMajorVersions)
+
+	isCompatible := func(npmMajorVersion uint64) (bool, error) {
+		nodeConstraint, err := semver.NewConstraint(npmVersions[strconv.FormatUint(npmMajorVersion, 10)])
+		if err != nil {
+			return false, err
+		}
+		return nodeConstraint.Check(semver.New(nodeMajorVersion, 0, 0, "", "")), nil
+	}
+
+	tarballs, err := getNpmTarballs(tarballsDir)
+	if err != nil {
+		return NpmInstallation{}, err
+	}
+
+	for _, tarball := range tarballs {
+		if !constraint.Check(tarball.version) || !slices.Contains(npmMajorVersions, tarball.version.Major()) {
+			continue
+		}
+		compatible, err := isCompatible(tarball.version.Major())
+		if err != nil {
+			return NpmInstallation{}, err
+		}
+		if compatible {
+			return NpmInstallation{Version: tarball.version.String(), Package: tarball.path, Source: "tarball"}, nil
+		}
+	}
+
+	// The registry installs the highest version matching the range, so the
+	// highest npm major version allowed by the range has to be compatible
+	var npmMajorVersion uint64
+	found := false
+	exactVersion, err := semver.StrictNewVersion(requestedVersion)
+	if err == nil {
+		npmMajorVersion, found = exactVersion.Major(), slices.Contains(npmMajorVersions, exactVersion.Major())
+	} else {
+		for _, major := range slices.Backward(npmMajorVersions) {
+			if allowsMajorVersion(constraint, major) {
+				npmMajorVersion, found = major, true
+				break
+			}
+		}
+	}
+
+	if !found {
+		var majors []string
+		for _, major := range npmMajorVersions {
+			majors = append(majors, strconv.FormatUint(major, 10))
+		}
+		return NpmInstallation{}, fmt.Errorf("npm version %q requested by %s does not match any known npm version, known npm major versions are: %s", requestedVersion, versionSource, strings.Join(majors, ", "))
+	}
+
+	compatible, err := isCompatible(npmMajorVersion)
+	if err != nil {
+		return NpmInstallation{}, err
+	}
+	if !compatible {
+		return NpmInstallation{}, fmt.Errorf("npm %d, resolved from %q requested by %s, is not compatible with Node.js %d, npm %d requires Node.js %s", npmMajorVersion, requestedVersion, versionSource, nodeMajorVersion, npmMajorVersion, npmVersions[strconv.FormatUint(npmMajorVersion, 10)])
+	}
+
+	if exactVersion != nil {
+		return NpmInstallation{Version: exactVersion.String(), Package: "npm@" + exactVersion.String(), Source: "registry"}, nil
+	}
+
+	// Restricting every alternative of the range keeps the registry from
+	// picking a npm major version which is not known yet
+	var ranges []string
+	for _, versionRange := range strings.Split(requestedVersion, "||") {
+		ranges = append(ranges, fmt.Sprintf("%s <%d.0.0-0", strings.TrimSpace(versionRange), npmMajorVersion+1))
+	}
+
+	return NpmInstallation{
+		Version: strings.Join(ranges, " || "),
+		Package: "npm@" + strings.Join(ranges, " || "),
+		Source:  "registry",
+	}, nil
+}
+
+type npmTarball struct {
+	path    string
+	version *semver.Version
+}
+
+// getNpmTarballs returns the npm-<version>.tgz tarballs of a directory, the
+// highest version first.
+func getNpmTarballs(tarballsDir string) ([]npmTarball, error) {
+	paths, err := filepath.Glob(filepath.Join(tarballsDir, "npm-*.tgz"))
+	if err != nil {
+		return nil, err
+	}
+
+	var tarballs []npmTarball
+	for _, path := range paths {
+		version, err := semver.StrictNewVersion(strings.TrimSuffix(strings.TrimPrefix(filepath.Base(path), "npm-"), ".tgz"))
+		if err != nil {
+			continue
+		}
+		tarballs = append(tarballs, npmTarball{path: path, version: version})
+	}
+
+	slices.SortFunc(tarballs, func(a, b npmTarball) int {
+		return b.version.Compare(a.version)
+	})
+
+	return tarballs, nil
+}
+
+// allowsMajorVersion checks whether a range allows any version of a major
+// version, probing the first and a far patch version of each minor version as
+// well as the versions the range mentions and the patch version above them.
+func allowsMajorVersion(constraint *semver.Constraints, major uint64) bool {
+	probes := []*semver.Version{}
+	for minor := uint64(0); minor < 100; minor++ {
+		probes = append(probes, semver.New(major, minor, 0, "", ""), semver.New(major, minor, 999, "", ""))
+	}
+
+	for _, mentioned := range versionRegexp.FindAllString(constraint.String(), -1) {
+		version, err := semver.NewVersion(mentioned)
+		if err == nil && version.Major() == major {
+			probes = append(probes, version, semver.New(major, version.Minor(), version.Patch()+1, "", ""))
+		}
+	}
+
+	return slices.ContainsFunc(probes, constraint.Check)
+}
@@ -0,0 +1,162 @@
+package utils_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/paketo-buildpacks/ubi-nodejs-extension/internal/utils"
+	"github.com/sclevine/spec"
+)
+
+func testGetRequestedNpmVersion(t *testing.T, context spec.G, it spec.S) {
+
+	var (
+		Expect      = NewWithT(t).Expect
+		projectPath string
+	)
+
+	it.Before(func() {
+		projectPath = t.TempDir()
+	})
+
+	it("It should return the version of BP_UBI_NPM_VERSION first", func() {
+		t.Setenv("BP_UBI_NPM_VERSION", "10.8.2")
+		Expect(os.WriteFile(filepath.Join(projectPath, "package.json"), []byte(`{"engines": {"npm": "^9.0.0"}}`), 0644)).To(Succeed())
+
+		version, versionSource, err := utils.GetRequestedNpmVersion(projectPath)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(version).To(Equal("10.8.2"))
+		Expect(versionSource).To(Equal("BP_UBI_NPM_VERSION"))
+	})
+
+	it("It should return the engines.npm version of package.json", func() {
+		Expect(os.WriteFile(filepath.Join(projectPath, "package.json"), []byte(`{"engines": {"node": "20", "npm": "^9.0.0"}}`), 0644)).To(Succeed())
+
+		version, versionSource, err := utils.GetRequestedNpmVersion(projectPath)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(version).To(Equal("^9.0.0"))
+		Expect(versionSource).To(Equal("package.json"))
+	})
+
+	it("It should return no version when none is requested", func() {
+		version, _, err := utils.GetRequestedNpmVersion(projectPath)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(version).To(BeEmpty())
+
+		Expect(os.WriteFile(filepath.Join(projectPath, "package.json"), []byte(`{"engines": {"node": "20"}}`), 0644)).To(Succeed())
+		version, _, err = utils.GetRequestedNpmVersion(projectPath)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(version).To(BeEmpty())
+	})
+
+	it("It should fail when package.json is not valid", func() {
+		Expect(os.WriteFile(filepath.Join(projectPath, "package.json"), []byte(`{"engines": `), 0644)).To(Succeed())
+
+		_, _, err := utils.GetRequestedNpmVersion(projectPath)
+		Expect(err).To(MatchError(ContainSubstring("failed to parse package.json")))
+	})
+}
+
+func testGetSatisfyingBundledNpmVersion(t *testing.T, context spec.G, it spec.S) {
+
+	var (
+		Expect = NewWithT(t).Expect
+	)
+
+	it("It should return the bundled npm version when it satisfies the range", func() {
+		bundledNpmVersion, err := utils.GetSatisfyingBundledNpmVersion(">=8", "package.json", 18)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(bundledNpmVersion).To(Equal("10.8.2"))
+	})
+
+	it("It should return no version when the bundled npm version does not satisfy the range", func() {
+		bundledNpmVersion, err := utils.GetSatisfyingBundledNpmVersion("^10.9.0", "package.json", 18)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(bundledNpmVersion).To(BeEmpty())
+	})
+
+	it("It should return no version when the bundled npm version is not known", func() {
+		bundledNpmVersion, err := utils.GetSatisfyingBundledNpmVersion(">=8", "package.json", 99)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(bundledNpmVersion).To(BeEmpty())
+	})
+
+	it("It should fail on an invalid range", func() {
+		_, err := utils.GetSatisfyingBundledNpmVersion("not a range", "BP_UBI_NPM_VERSION", 18)
+		Expect(err).To(MatchError(ContainSubstring(`invalid npm version "not a range" requested by BP_UBI_NPM_VERSION`)))
+	})
+}
+
+func testResolveNpmVersion(t *testing.T, context spec.G, it spec.S) {
+
+	var (
+		Expect      = NewWithT(t).Expect
+		tarballsDir string
+	)
+
+	it.Before(func() {
+		tarballsDir = t.TempDir()
+		for _, tarball := range []string{"npm-9.9.3.tgz", "npm-10.8.2.tgz", "npm-11.1.0.tgz", "npm-latest.tgz"} {
+			Expect(os.WriteFile(filepath.Join(tarballsDir, tarball), []byte{}, 0644)).To(Succeed())
+		}
+	})
+
+	context("When a tarball of the builder matches", func() {
+
+		it("It should pick the highest compatible tarball", func() {
+			npmInstallation, err := utils.ResolveNpmVersion(">=9", "package.json", 18, tarballsDir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(npmInstallation).To(Equal(utils.NpmInstallation{
+				Version: "10.8.2",
+				Package: filepath.Join(tarballsDir, "npm-10.8.2.tgz"),
+				Source:  "tarball",
+			}))
+		})
+	})
+
+	context("When no tarball of the builder matches", func() {
+
+		it("It should install the range from the registry", func() {
+			npmInstallation, err := utils.ResolveNpmVersion("~10.2.0", "BP_UBI_NPM_VERSION", 20, tarballsDir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(npmInstallation).To(Equal(utils.NpmInstallation{
+				Version: "~10.2.0 <11.0.0-0",
+				Package: "npm@~10.2.0 <11.0.0-0",
+				Source:  "registry",
+			}))
+		})
+
+		it("It should install an exact version as is", func() {
+			npmInstallation, err := utils.ResolveNpmVersion("9.9.4", "BP_UBI_NPM_VERSION", 20, tarballsDir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(npmInstallation).To(Equal(utils.NpmInstallation{
+				Version: "9.9.4",
+				Package: "npm@9.9.4",
+				Source:  "registry",
+			}))
+		})
+
+		it("It should restrict every alternative of the range to the known npm versions", func() {
+			npmInstallation, err := utils.ResolveNpmVersion("^8.0.0 || >=10", "package.json", 22, t.TempDir())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(npmInstallation.Package).To(Equal("npm@^8.0.0 <12.0.0-0 || >=10 <12.0.0-0"))
+		})
+
+		it("It should fail when npm is not compatible with Node.js", func() {
+			_, err := utils.ResolveNpmVersion("^11.0.0", "package.json", 18, tarballsDir)
+			Expect(err).To(MatchError(`npm 11, resolved from "^11.0.0" requested by package.json, is not compatible with Node.js 18, npm 11 requires Node.js >=20`))
+		})
+
+		it("It should fail when the range does not match any known npm version", func() {
+			_, err := utils.ResolveNpmVersion("^42.0.0", "package.json", 20, tarballsDir)
+			Expect(err).To(MatchError(`npm version "^42.0.0" requested by package.json does not match any known npm version, known npm major versions are: 6, 7, 8, 9, 10, 11`))
+		})
+
+		it("It should fail when the version is not a valid range", func() {
+			_, err := utils.ResolveNpmVersion("latest", "BP_UBI_NPM_VERSION", 20, tarballsDir)
+			Expect(err).To(MatchError(ContainSubstring(`invalid npm version "latest" requested by BP_UBI_NPM_VERSION`)))
+		})
+	})
+}
@@ -0,0 +1,97 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/paketo-buildpacks/ubi-nodejs-extension/structs"
+)
+
+// PackageManager describes how one of the package managers shipped on UBI
+// images enables module streams, installs, pins and cleans packages.
+type PackageManager struct {
+	Name           string
+	InstallOptions []string
+	// ModuleStreams is true when the package manager is able to enable module streams
+	ModuleStreams bool
+}
+
+var MICRODNF = PackageManager{
+	Name:           "microdnf",
+	InstallOptions: []string{"--setopt=install_weak_deps=0", "--setopt=tsflags=nodocs"},
+	ModuleStreams:  true,
+}
+
+var DNF = PackageManager{
+	Name:           "dnf",
+	InstallOptions: []string{"--setopt=install_weak_deps=0", "--setopt=tsflags=nodocs"},
+	ModuleStreams:  true,
+}
+
+var DNF5 = PackageManager{
+	Name:           "dnf5",
+	InstallOptions: []string{"--setopt=install_weak_deps=False", "--setopt=tsflags=nodocs"},
+	ModuleStreams:  false,
+}
+
+// Package managers in the order they are probed on the build image,
+// ubi-minimal images only shipping microdnf
+var PACKAGE_MANAGERS = []PackageManager{MICRODNF, DNF5, DNF}
+
+// DetectPackageManager returns the first package manager found on the binary
+// directory of the build image, defaulting to microdnf.
+func DetectPackageManager(binDir string) PackageManager {
+	for _, packageManager := range PACKAGE_MANAGERS {
+		if info, err := os.Stat(filepath.Join(binDir, packageManager.Name)); err == nil && !info.IsDir() {
+			return packageManager
+		}
+	}
+
+	return MICRODNF
+}
+
+// GetPackageManager returns the package manager with the given name,
+// defaulting to microdnf when no name is given.
+func GetPackageManager(name string) (PackageManager, error) {
+	if name == "" {
+		return MICRODNF, nil
+	}
+
+	var supportedNames []string
+	for _, packageManager := range PACKAGE_MANAGERS {
+		if packageManager.Name == name {
+			return packageManager, nil
+		}
+		supportedNames = append(supportedNames, packageManager.Name)
+	}
+
+	return PackageManager{}, fmt.Errorf("package manager %s is not supported, supported package managers are: %s", name, strings.Join(supportedNames, ", "))
+}
+
+func (packageManager PackageManager) EnableModule() string {
+	return fmt.Sprintf("%s -y module enable", packageManager.Name)
+}
+
+func (packageManager PackageManager) Install() string {
+	return fmt.Sprintf("%s %s install -y", packageManager.Name, strings.Join(packageManager.InstallOptions, " "))
+}
+
+// PinVersion returns the package spec installing the given version of a package
+func (packageManager PackageManager) PinVersion(pkg string, version string) string {
+	return fmt.Sprintf("%s-%s", pkg, version)
+}
+
+func (packageManager PackageManager) Clean() string {
+	return fmt.Sprintf("%s clean all", packageManager.Name)
+}
+
+// Commands returns the command lines used on the generated Dockerfiles
+func (packageManager PackageManager) Commands() structs.PackageManagerCommands {
+	return structs.PackageManagerCommands{
+		EnableModule: packageManager.EnableModule(),
+		Install:      packageManager.Install(),
+		Clean:        packageManager.Clean(),
+	}
+}
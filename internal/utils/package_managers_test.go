@@ -0,0 +1,92 @@
+package utils_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/paketo-buildpacks/ubi-nodejs-extension/internal/utils"
+	"github.com/paketo-buildpacks/ubi-nodejs-extension/structs"
+	"github.com/sclevine/spec"
+)
+
+func testDetectPackageManager(t *testing.T, context spec.G, it spec.S) {
+
+	var (
+		Expect = NewWithT(t).Expect
+		binDir string
+	)
+
+	it.Before(func() {
+		binDir = t.TempDir()
+	})
+
+	it("It should default to microdnf when no package manager is found", func() {
+		Expect(utils.DetectPackageManager(binDir)).To(Equal(utils.MICRODNF))
+	})
+
+	it("It should detect dnf on full UBI images", func() {
+		Expect(os.WriteFile(filepath.Join(binDir, "dnf"), []byte{}, 0755)).To(Succeed())
+		Expect(utils.DetectPackageManager(binDir)).To(Equal(utils.DNF))
+	})
+
+	it("It should prefer dnf5 over dnf", func() {
+		Expect(os.WriteFile(filepath.Join(binDir, "dnf"), []byte{}, 0755)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(binDir, "dnf5"), []byte{}, 0755)).To(Succeed())
+		Expect(utils.DetectPackageManager(binDir)).To(Equal(utils.DNF5))
+	})
+
+	it("It should prefer microdnf when it is available", func() {
+		Expect(os.WriteFile(filepath.Join(binDir, "dnf"), []byte{}, 0755)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(binDir, "microdnf"), []byte{}, 0755)).To(Succeed())
+		Expect(utils.DetectPackageManager(binDir)).To(Equal(utils.MICRODNF))
+	})
+}
+
+func testGetPackageManager(t *testing.T, context spec.G, it spec.S) {
+
+	var (
+		Expect = NewWithT(t).Expect
+	)
+
+	it("It should return the package manager with the given name", func() {
+		packageManager, err := utils.GetPackageManager("dnf5")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(packageManager).To(Equal(utils.DNF5))
+	})
+
+	it("It should default to microdnf", func() {
+		packageManager, err := utils.GetPackageManager("")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(packageManager).To(Equal(utils.MICRODNF))
+	})
+
+	it("It should error on unknown package managers", func() {
+		_, err := utils.GetPackageManager("yum")
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(Equal("package manager yum is not supported, supported package managers are: microdnf, dnf5, dnf"))
+	})
+
+	context("When expressing the package operations", func() {
+
+		it("It should use the options of each package manager", func() {
+			Expect(utils.MICRODNF.Commands()).To(Equal(structs.PackageManagerCommands{
+				EnableModule: "microdnf -y module enable",
+				Install:      "microdnf --setopt=install_weak_deps=0 --setopt=tsflags=nodocs install -y",
+				Clean:        "microdnf clean all",
+			}))
+			Expect(utils.DNF.Commands()).To(Equal(structs.PackageManagerCommands{
+				EnableModule: "dnf -y module enable",
+				Install:      "dnf --setopt=install_weak_deps=0 --setopt=tsflags=nodocs install -y",
+				Clean:        "dnf clean all",
+			}))
+			Expect(utils.DNF5.Install()).To(Equal("dnf5 --setopt=install_weak_deps=False --setopt=tsflags=nodocs install -y"))
+			Expect(utils.DNF5.Clean()).To(Equal("dnf5 clean all"))
+		})
+
+		it("It should pin the version of a package", func() {
+			Expect(utils.DNF.PinVersion("nodejs", "20.11.1")).To(Equal("nodejs-20.11.1"))
+		})
+	})
+}
@@ -0,0 +1,140 @@
+package utils
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/paketo-buildpacks/ubi-nodejs-extension/structs"
+
+	"github.com/google/go-containerregistry/pkg/name"
+)
+
+// The values spliced into the Dockerfiles are validated against the grammar of
+// their context, so none of them can carry a newline or shell metacharacters.
+var (
+	packageNameRegexp       = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9._+~:-]*$`)
+	stackIdRegexp           = regexp.MustCompile(`^[A-Za-z0-9._/*-]*$`)
+	targetRegexp            = regexp.MustCompile(`^[A-Za-z0-9._/ -]*$`)
+	nodejsProfileRegexp     = regexp.MustCompile(`^[a-z0-9-]*$`)
+	certificateNameRegexp   = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+	base64ContentRegexp     = regexp.MustCompile(`^[A-Za-z0-9+/=]+$`)
+	labelKeyRegexp          = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]*$`)
+	packageManagerCmdRegexp = regexp.MustCompile(`^[A-Za-z0-9._=/ -]+$`)
+	npmPackageRegexp        = regexp.MustCompile(`^[A-Za-z0-9@._/*^~<>=| -]*$`)
+	npmRegistryRegexp       = regexp.MustCompile(`^(https?://[A-Za-z0-9._~:/@%+-]+)?$`)
+)
+
+// ValidatePackageNames checks that every package of a space separated list
+// follows the rpm package name grammar.
+func ValidatePackageNames(packages string) error {
+	if strings.ContainsAny(packages, "\r\n\t") {
+		return fmt.Errorf("package list %q contains a control character", packages)
+	}
+
+	for _, pkg := range strings.Fields(packages) {
+		if !packageNameRegexp.MatchString(pkg) {
+			return fmt.Errorf("%q is not a valid package name", pkg)
+		}
+	}
+
+	return nil
+}
+
+// ValidateImageReference checks that an image reference follows the OCI
+// reference grammar.
+func ValidateImageReference(reference string) error {
+	if reference != strings.TrimSpace(reference) || strings.ContainsAny(reference, " \r\n\t") {
+		return fmt.Errorf("image reference %q contains whitespaces", reference)
+	}
+
+	if _, err := name.ParseReference(reference); err != nil {
+		return fmt.Errorf("image reference %q is not valid: %w", reference, err)
+	}
+
+	return nil
+}
+
+// ValidateNpmRegistry checks that a npm registry is an http or https URL.
+func ValidateNpmRegistry(registry string) error {
+	if !npmRegistryRegexp.MatchString(registry) {
+		return fmt.Errorf("npm registry %q is not a valid http or https URL", registry)
+	}
+
+	return nil
+}
+
+// ValidateBuildDockerfileProps checks every value templated into the build Dockerfile.
+func ValidateBuildDockerfileProps(buildProps structs.BuildDockerfileProps) error {
+	if !stackIdRegexp.MatchString(buildProps.CNB_STACK_ID) {
+		return fmt.Errorf("stack id %q contains characters which are not allowed", buildProps.CNB_STACK_ID)
+	}
+
+	if !targetRegexp.MatchString(buildProps.CNB_TARGET) {
+		return fmt.Errorf("target %q contains characters which are not allowed", buildProps.CNB_TARGET)
+	}
+
+	if !nodejsProfileRegexp.MatchString(buildProps.NODEJS_PROFILE) {
+		return fmt.Errorf("Node.js module profile %q contains characters which are not allowed", buildProps.NODEJS_PROFILE)
+	}
+
+	if err := ValidatePackageNames(buildProps.PACKAGES); err != nil {
+		return err
+	}
+
+	if err := validatePackageManagerCommands(buildProps.PACKAGE_MANAGER); err != nil {
+		return err
+	}
+
+	if !npmPackageRegexp.MatchString(buildProps.NPM_PACKAGE) {
+		return fmt.Errorf("npm package %q contains characters which are not allowed", buildProps.NPM_PACKAGE)
+	}
+
+	if err := ValidateNpmRegistry(buildProps.NPM_REGISTRY); err != nil {
+		return err
+	}
+
+	for _, caCertificate := range buildProps.CA_CERTIFICATES {
+		if !certificateNameRegexp.MatchString(caCertificate.Name) {
+			return fmt.Errorf("CA certificate name %q contains characters which are not allowed", caCertificate.Name)
+		}
+		if !base64ContentRegexp.MatchString(caCertificate.Content) {
+			return fmt.Errorf("content of the CA certificate %s is not base64 encoded", caCertificate.Name)
+		}
+	}
+
+	return nil
+}
+
+// ValidateRunDockerfileProps checks every value templated into the run Dockerfile.
+// Label values are quoted by the template, only newlines can escape them.
+func ValidateRunDockerfileProps(runProps structs.RunDockerfileProps) error {
+	if err := ValidateImageReference(runProps.Source); err != nil {
+		return fmt.Errorf("invalid run image: %w", err)
+	}
+
+	for key, value := range runProps.Labels {
+		if !labelKeyRegexp.MatchString(key) {
+			return fmt.Errorf("label key %q contains characters which are not allowed", key)
+		}
+		if strings.ContainsAny(value, "\r\n") {
+			return fmt.Errorf("value of the label %s contains a newline", key)
+		}
+	}
+
+	if err := ValidatePackageNames(runProps.PACKAGES); err != nil {
+		return err
+	}
+
+	return validatePackageManagerCommands(runProps.PACKAGE_MANAGER)
+}
+
+func validatePackageManagerCommands(commands structs.PackageManagerCommands) error {
+	for _, command := range []string{commands.EnableModule, commands.Install, commands.Clean} {
+		if !packageManagerCmdRegexp.MatchString(command) {
+			return fmt.Errorf("package manager command %q contains characters which are not allowed", command)
+		}
+	}
+
+	return nil
+}
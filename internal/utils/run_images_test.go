@@ -0,0 +1,87 @@
+package utils_test
+
+import (
+	"bytes"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/paketo-buildpacks/packit/v2/scribe"
+	"github.com/paketo-buildpacks/ubi-nodejs-extension/constants"
+	"github.com/paketo-buildpacks/ubi-nodejs-extension/internal/utils"
+	"github.com/sclevine/spec"
+)
+
+func testSelectRunImage(t *testing.T, context spec.G, it spec.S) {
+
+	var (
+		Expect = NewWithT(t).Expect
+		buffer *bytes.Buffer
+		logger scribe.Emitter
+	)
+
+	it.Before(func() {
+		buffer = bytes.NewBuffer(nil)
+		logger = scribe.NewEmitter(buffer)
+	})
+
+	it("It should select the run image of images.json when Node.js is required at launch", func() {
+		runImage, err := utils.SelectRunImage(logger, true, "paketocommunity/run-nodejs-18-ubi-base")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(runImage).To(Equal(utils.RunImageSelection{Image: "paketocommunity/run-nodejs-18-ubi-base", Source: "images.json"}))
+	})
+
+	it("It should select the run image set by BP_UBI_RUN_IMAGE_OVERRIDE", func() {
+		t.Setenv("BP_UBI_RUN_IMAGE_OVERRIDE", "registry.example.com/run")
+		t.Setenv("BP_UBI_BUILD_ONLY_RUN_IMAGE", "registry.example.com/build-only-run")
+
+		runImage, err := utils.SelectRunImage(logger, false, "paketocommunity/run-nodejs-18-ubi-base")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(runImage).To(Equal(utils.RunImageSelection{Image: "registry.example.com/run", Source: "BP_UBI_RUN_IMAGE_OVERRIDE"}))
+		Expect(buffer.String()).To(ContainSubstring("Using run image specified by BP_UBI_RUN_IMAGE_OVERRIDE registry.example.com/run"))
+	})
+
+	context("When Node.js is only required at build time", func() {
+
+		it("It should keep the run image of the builder", func() {
+			runImage, err := utils.SelectRunImage(logger, false, "paketocommunity/run-nodejs-18-ubi-base")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(runImage).To(Equal(utils.RunImageSelection{Source: "builder"}))
+		})
+
+		it("It should select the run image set by BP_UBI_BUILD_ONLY_RUN_IMAGE", func() {
+			t.Setenv("BP_UBI_BUILD_ONLY_RUN_IMAGE", "registry.example.com/build-only-run")
+
+			runImage, err := utils.SelectRunImage(logger, false, "paketocommunity/run-nodejs-18-ubi-base")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(runImage).To(Equal(utils.RunImageSelection{Image: "registry.example.com/build-only-run", Source: "BP_UBI_BUILD_ONLY_RUN_IMAGE"}))
+		})
+
+		it("It should fail on an invalid run image", func() {
+			t.Setenv("BP_UBI_BUILD_ONLY_RUN_IMAGE", "registry.example.com/run; id")
+
+			_, err := utils.SelectRunImage(logger, false, "paketocommunity/run-nodejs-18-ubi-base")
+			Expect(err).To(MatchError(ContainSubstring("invalid run image set by BP_UBI_BUILD_ONLY_RUN_IMAGE")))
+		})
+	})
+}
+
+func testGetRunImageLabels(t *testing.T, context spec.G, it spec.S) {
+
+	var (
+		Expect = NewWithT(t).Expect
+	)
+
+	it("It should label the Node.js version when Node.js is required at launch", func() {
+		labels := utils.GetRunImageLabels("registry.example.com/run", "1.2.3", 18, true)
+		Expect(labels).To(HaveKeyWithValue(constants.SOURCE_IMAGE_LABEL, "registry.example.com/run"))
+		Expect(labels).To(HaveKeyWithValue(constants.EXTENSION_VERSION_LABEL, "1.2.3"))
+		Expect(labels).To(HaveKeyWithValue(constants.NODEJS_VERSION_LABEL, "nodejs:18"))
+		Expect(labels).To(HaveKeyWithValue(constants.NODEJS_MAJOR_VERSION_LABEL, "18"))
+	})
+
+	it("It should not label the Node.js version when Node.js is only required at build time", func() {
+		labels := utils.GetRunImageLabels("registry.example.com/run", "1.2.3", 18, false)
+		Expect(labels).To(HaveKeyWithValue(constants.OCI_BASE_NAME_LABEL, "registry.example.com/run"))
+		Expect(labels).NotTo(HaveKey(constants.NODEJS_VERSION_LABEL))
+	})
+}
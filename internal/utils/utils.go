@@ -4,19 +4,29 @@ import (
 	_ "embed"
 
 	"bytes"
+	"encoding/base64"
 	"encoding/json"
+	"encoding/pem"
 	"errors"
 	"fmt"
+	"maps"
 	"os"
+	"path/filepath"
 	"regexp"
+	"runtime"
+	"slices"
 	"strconv"
 	"strings"
 	"text/template"
+	"time"
 
 	"github.com/paketo-buildpacks/ubi-nodejs-extension/constants"
 	"github.com/paketo-buildpacks/ubi-nodejs-extension/structs"
 
 	"github.com/BurntSushi/toml"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/paketo-buildpacks/packit/v2"
+	"github.com/paketo-buildpacks/packit/v2/servicebindings"
 )
 
 //go:embed templates/build.Dockerfile
@@ -26,38 +36,90 @@ var buildDockerfileTemplate string
 var runDockerfileTemplate string
 
 type StackImages struct {
-	Name              string `json:"name"`
-	IsDefaultRunImage bool   `json:"is_default_run_image,omitempty"`
+	Name              string            `json:"name"`
+	IsDefaultRunImage bool              `json:"is_default_run_image,omitempty"`
+	Platforms         []string          `json:"platforms,omitempty"`
+	RunImages         map[string]string `json:"run_images,omitempty"`
+	DistroVersion     string            `json:"distro_version,omitempty"`
 	NodeVersion       string
+	Variant           string
 }
 
 type ImagesJson struct {
 	StackImages []StackImages `json:"images"`
 }
 
-func GenerateConfigTomlContentFromImagesJson(imagesJsonPath string, stackId string) ([]byte, error) {
-	imagesJsonData, err := ParseImagesJsonFile(imagesJsonPath)
+// GenerateConfigTomlContentFromImagesJson returns the config.toml offering the
+// Node.js stacks of the images.json file for the platform and the UBI version.
+// The default version is left out when none is given, as it is only needed
+// when the app does not request any version.
+func GenerateConfigTomlContentFromImagesJson(imagesJsonPath string, stackId string, platform string, distroVersion string, defaultNodeVersion string) ([]byte, error) {
+	nodejsStacks, err := getOfferedNodejsStackImages(imagesJsonPath, distroVersion)
 	if err != nil {
 		return []byte{}, err
 	}
 
-	nodejsStacks, err := GetNodejsStackImages(imagesJsonData)
+	nodejsStacks, err = FilterStackImagesByPlatform(nodejsStacks, platform)
 	if err != nil {
 		return []byte{}, err
 	}
 
-	defaultNodeVersion, err := GetDefaultNodeVersion(nodejsStacks)
+	configTomlContent, err := CreateConfigTomlFileContent(defaultNodeVersion, nodejsStacks, stackId, platform)
 	if err != nil {
 		return []byte{}, err
 	}
 
-	configTomlContent, err := CreateConfigTomlFileContent(defaultNodeVersion, nodejsStacks, stackId)
+	configTomlContentString := configTomlContent.Bytes()
+	return configTomlContentString, nil
+}
+
+// GetDefaultNodeVersionForPlatform returns the Node.js version of the apps which
+// do not request any. The default version of the builder has to be offered for
+// the platform, the other default version policies select it among the stacks
+// of the platform.
+func GetDefaultNodeVersionForPlatform(imagesJsonPath string, platform string, distroVersion string, defaultVersionPolicy string, date time.Time) (string, error) {
+	nodejsStacks, err := getOfferedNodejsStackImages(imagesJsonPath, distroVersion)
 	if err != nil {
-		return []byte{}, err
+		return "", err
 	}
 
-	configTomlContentString := configTomlContent.Bytes()
-	return configTomlContentString, nil
+	builderDefaultPolicy := defaultVersionPolicy == "" || defaultVersionPolicy == "builder-default"
+
+	var defaultNodeVersion string
+	if builderDefaultPolicy {
+		defaultNodeVersion, err = GetDefaultNodeVersion(nodejsStacks)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	nodejsStacks, err = FilterStackImagesByPlatform(nodejsStacks, platform)
+	if err != nil {
+		return "", err
+	}
+
+	if builderDefaultPolicy {
+		if _, err = GetDefaultNodeVersion(nodejsStacks); err != nil {
+			return "", fmt.Errorf("default node.js version %s is not offered for platform %s", defaultNodeVersion, platform)
+		}
+		return defaultNodeVersion, nil
+	}
+
+	return GetDefaultNodeVersionByPolicy(nodejsStacks, defaultVersionPolicy, date)
+}
+
+func getOfferedNodejsStackImages(imagesJsonPath string, distroVersion string) ([]StackImages, error) {
+	imagesJsonData, err := ParseImagesJsonFile(imagesJsonPath)
+	if err != nil {
+		return nil, err
+	}
+
+	nodejsStacks, err := GetNodejsStackImages(imagesJsonData)
+	if err != nil {
+		return nil, err
+	}
+
+	return FilterStackImagesByDistroVersion(nodejsStacks, distroVersion)
 }
 
 func GetDefaultNodeVersion(stacks []StackImages) (string, error) {
@@ -76,7 +138,7 @@ func GetDefaultNodeVersion(stacks []StackImages) (string, error) {
 	}
 }
 
-func CreateConfigTomlFileContent(defaultNodeVersion string, nodejsStacks []StackImages, stackId string) (bytes.Buffer, error) {
+func CreateConfigTomlFileContent(defaultNodeVersion string, nodejsStacks []StackImages, stackId string, platform string) (bytes.Buffer, error) {
 
 	var dependencies []map[string]interface{}
 
@@ -85,18 +147,22 @@ func CreateConfigTomlFileContent(defaultNodeVersion string, nodejsStacks []Stack
 			"id":      "node",
 			"stacks":  []string{stackId},
 			"version": fmt.Sprintf("%s.1000", stack.NodeVersion),
-			"source":  fmt.Sprintf("paketocommunity/run-nodejs-%s-ubi-base", stack.NodeVersion),
+			"source":  GetStackRunImage(stack, platform),
 		}
 		dependencies = append(dependencies, dependency)
 	}
 
+	metadata := map[string]interface{}{
+		"dependencies": dependencies,
+	}
+	if defaultNodeVersion != "" {
+		metadata["default-versions"] = map[string]string{
+			"node": fmt.Sprintf("%s.*.*", defaultNodeVersion),
+		}
+	}
+
 	config := map[string]interface{}{
-		"metadata": map[string]interface{}{
-			"default-versions": map[string]string{
-				"node": fmt.Sprintf("%s.*.*", defaultNodeVersion),
-			},
-			"dependencies": dependencies,
-		},
+		"metadata": metadata,
 	}
 
 	buf := new(bytes.Buffer)
@@ -116,17 +182,12 @@ func GetNodejsStackImages(imagesJsonData ImagesJson) ([]StackImages, error) {
 	for _, stack := range imagesJsonData.StackImages {
 
 		if nodejsRegex.MatchString(stack.Name) {
-			//Extract the node version from the stack name
-			extractedNodeVersion := strings.Split(stack.Name, "-")[1]
-
-			_, err := strconv.Atoi(extractedNodeVersion)
+			nodejsStack, err := parseNodejsStackImage(stack)
 			if err != nil {
-				return []StackImages{}, fmt.Errorf("extracted Node.js version [%s] for stack %s is not an integer", extractedNodeVersion, stack.Name)
+				return []StackImages{}, err
 			}
 
-			stack.NodeVersion = extractedNodeVersion
-
-			nodejsStacks = append(nodejsStacks, stack)
+			nodejsStacks = append(nodejsStacks, nodejsStack)
 		}
 	}
 	if len(nodejsStacks) == 0 {
@@ -136,6 +197,210 @@ func GetNodejsStackImages(imagesJsonData ImagesJson) ([]StackImages, error) {
 	return nodejsStacks, nil
 }
 
+// parseNodejsStackImage extracts the node version and the optional variant
+// from the name of a nodejs stack, e.g. nodejs-20-minimal.
+func parseNodejsStackImage(stack StackImages) (StackImages, error) {
+	stackNameParts := strings.Split(stack.Name, "-")
+
+	var extractedNodeVersion string
+	if len(stackNameParts) > 1 {
+		extractedNodeVersion = stackNameParts[1]
+	}
+
+	if _, err := strconv.Atoi(extractedNodeVersion); err != nil {
+		return StackImages{}, fmt.Errorf("extracted Node.js version [%s] for stack %s is not an integer", extractedNodeVersion, stack.Name)
+	}
+
+	stack.NodeVersion = extractedNodeVersion
+	if len(stackNameParts) > 2 {
+		stack.Variant = strings.Join(stackNameParts[2:], "-")
+	}
+
+	return stack, nil
+}
+
+func GetRunImageReference(nodeVersion string) string {
+	return fmt.Sprintf("paketocommunity/run-nodejs-%s-ubi-base", nodeVersion)
+}
+
+// GetStackRunImage returns the run image a stack declares for the given
+// platform, falling back to the multi-arch run image of its Node.js version.
+func GetStackRunImage(stack StackImages, platform string) string {
+	if runImage, found := stack.RunImages[platform]; found && runImage != "" {
+		return runImage
+	}
+
+	return GetRunImageReference(stack.NodeVersion)
+}
+
+// GetTargetPlatform returns the os/arch the build is running on, as exposed by
+// the lifecycle through the CNB_TARGET_* variables.
+func GetTargetPlatform() string {
+	targetOs := os.Getenv("CNB_TARGET_OS")
+	if targetOs == "" {
+		targetOs = "linux"
+	}
+
+	targetArch := os.Getenv("CNB_TARGET_ARCH")
+	if targetArch == "" {
+		targetArch = runtime.GOARCH
+	}
+
+	return fmt.Sprintf("%s/%s", targetOs, targetArch)
+}
+
+// IsNodeRequiredAtLaunch tells whether the node plan entries require Node.js
+// in the run image. Entries only requesting it with build = true, such as apps
+// bundled into static assets, do not.
+func IsNodeRequiredAtLaunch(entries []packit.BuildpackPlanEntry) bool {
+	buildOnly := false
+	for _, entry := range entries {
+		if entry.Name != "node" {
+			continue
+		}
+		if launch, _ := entry.Metadata["launch"].(bool); launch {
+			return true
+		}
+		if build, _ := entry.Metadata["build"].(bool); build {
+			buildOnly = true
+		}
+	}
+
+	return !buildOnly
+}
+
+// GetTargetStack returns the stack the dependencies are resolved for. Builders
+// on buildpack API 0.10 and later only expose targets, in which case the
+// dependencies match any stack and are selected by platform and distro.
+func GetTargetStack(stackId string) string {
+	if stackId == "" {
+		return "*"
+	}
+
+	return stackId
+}
+
+// GetTargetDescription describes the target the build runs on, e.g. "linux/amd64 rhel 9.4"
+func GetTargetDescription(platform string, distro structs.Distro) string {
+	return strings.TrimSpace(strings.Join([]string{platform, distro.Name, distro.Version}, " "))
+}
+
+// FilterStackImagesByPlatform keeps the stacks offered for the given platform.
+// Stacks which do not declare any platform are considered available on all of them.
+func FilterStackImagesByPlatform(nodejsStacks []StackImages, platform string) ([]StackImages, error) {
+	platformStacks := []StackImages{}
+	for _, stack := range nodejsStacks {
+		if len(stack.Platforms) == 0 || slices.Contains(stack.Platforms, platform) {
+			platformStacks = append(platformStacks, stack)
+		}
+	}
+
+	if len(platformStacks) == 0 {
+		return []StackImages{}, fmt.Errorf("no nodejs stacks offered for platform %s", platform)
+	}
+
+	return platformStacks, nil
+}
+
+// FilterStackImagesByDistroVersion keeps the stacks offered for the given UBI
+// major version. Stacks which do not declare any distro version are
+// considered available on all of them.
+func FilterStackImagesByDistroVersion(nodejsStacks []StackImages, distroVersion string) ([]StackImages, error) {
+	distroStacks := []StackImages{}
+	for _, stack := range nodejsStacks {
+		if stack.DistroVersion == "" || stack.DistroVersion == distroVersion {
+			distroStacks = append(distroStacks, stack)
+		}
+	}
+
+	if len(distroStacks) == 0 {
+		return []StackImages{}, fmt.Errorf("no nodejs stacks offered for UBI %s", distroVersion)
+	}
+
+	return distroStacks, nil
+}
+
+// ValidateImagesJson reports every inconsistency found on the nodejs stacks
+// of an images.json file, so builder authors can fix them all at once.
+func ValidateImagesJson(imagesJsonData ImagesJson) []error {
+	var problems []error
+
+	var nodejsStacks []StackImages
+	for _, stack := range imagesJsonData.StackImages {
+		if !strings.HasPrefix(stack.Name, "nodejs") {
+			continue
+		}
+
+		nodejsStack, err := parseNodejsStackImage(stack)
+		if err != nil {
+			problems = append(problems, err)
+			continue
+		}
+		nodejsStacks = append(nodejsStacks, nodejsStack)
+	}
+
+	if len(nodejsStacks) == 0 {
+		return append(problems, errors.New("no nodejs stacks found"))
+	}
+
+	var distroVersions []string
+	for _, stack := range nodejsStacks {
+		if stack.DistroVersion != "" && !slices.Contains(distroVersions, stack.DistroVersion) {
+			distroVersions = append(distroVersions, stack.DistroVersion)
+		}
+	}
+
+	if len(distroVersions) == 0 {
+		if _, err := GetDefaultNodeVersion(nodejsStacks); err != nil {
+			problems = append(problems, err)
+		}
+	}
+
+	// Each UBI version needs its own default Node.js version
+	for _, distroVersion := range distroVersions {
+		distroStacks, _ := FilterStackImagesByDistroVersion(nodejsStacks, distroVersion)
+		if _, err := GetDefaultNodeVersion(distroStacks); err != nil {
+			problems = append(problems, fmt.Errorf("%w for UBI %s", err, distroVersion))
+		}
+	}
+
+	var nodeVersions []string
+	stacksPerNodeVersion := map[string][]string{}
+	for _, stack := range nodejsStacks {
+		// The same Node.js version can be offered once per UBI version
+		nodeVersion := stack.NodeVersion
+		if stack.DistroVersion != "" {
+			nodeVersion = fmt.Sprintf("%s on UBI %s", stack.NodeVersion, stack.DistroVersion)
+		}
+		if _, found := stacksPerNodeVersion[nodeVersion]; !found {
+			nodeVersions = append(nodeVersions, nodeVersion)
+		}
+		stacksPerNodeVersion[nodeVersion] = append(stacksPerNodeVersion[nodeVersion], stack.Name)
+
+		for _, platform := range stack.Platforms {
+			if len(strings.Split(platform, "/")) != 2 {
+				problems = append(problems, fmt.Errorf("platform [%s] for stack %s is not in the os/arch format", platform, stack.Name))
+			}
+		}
+		for _, platform := range slices.Sorted(maps.Keys(stack.RunImages)) {
+			if len(stack.Platforms) > 0 && !slices.Contains(stack.Platforms, platform) {
+				problems = append(problems, fmt.Errorf("run image for platform %s of stack %s is not part of its platforms", platform, stack.Name))
+			}
+			if _, err := name.ParseReference(stack.RunImages[platform]); err != nil {
+				problems = append(problems, fmt.Errorf("run image reference [%s] for platform %s of stack %s is not valid: %w", stack.RunImages[platform], platform, stack.Name, err))
+			}
+		}
+	}
+
+	for _, nodeVersion := range nodeVersions {
+		if len(stacksPerNodeVersion[nodeVersion]) > 1 {
+			problems = append(problems, fmt.Errorf("node.js version %s is declared by multiple stacks: %s", nodeVersion, strings.Join(stacksPerNodeVersion[nodeVersion], ", ")))
+		}
+	}
+
+	return problems
+}
+
 func ParseImagesJsonFile(imagesJsonPath string) (ImagesJson, error) {
 	filepath, err := os.Open(imagesJsonPath)
 	if err != nil {
@@ -193,8 +458,22 @@ func GetDuringBuildPermissions(filepath string) structs.DuringBuildPermissions {
 }
 
 func GenerateBuildDockerfile(buildProps structs.BuildDockerfileProps) (result string, Error error) {
+	return GenerateBuildDockerfileFromTemplate(buildDockerfileTemplate, buildProps)
+}
 
-	result, err := fillPropsToTemplate(buildProps, buildDockerfileTemplate)
+// GenerateBuildDockerfileFromTemplate renders a build Dockerfile template,
+// either the embedded one or one provided by the builder.
+func GenerateBuildDockerfileFromTemplate(templateString string, buildProps structs.BuildDockerfileProps) (result string, Error error) {
+
+	if buildProps.PACKAGE_MANAGER == (structs.PackageManagerCommands{}) {
+		buildProps.PACKAGE_MANAGER = MICRODNF.Commands()
+	}
+
+	if err := ValidateBuildDockerfileProps(buildProps); err != nil {
+		return "", err
+	}
+
+	result, err := fillPropsToTemplate(buildProps, templateString)
 
 	if err != nil {
 		return "", err
@@ -204,8 +483,22 @@ func GenerateBuildDockerfile(buildProps structs.BuildDockerfileProps) (result st
 }
 
 func GenerateRunDockerfile(runProps structs.RunDockerfileProps) (result string, Error error) {
+	return GenerateRunDockerfileFromTemplate(runDockerfileTemplate, runProps)
+}
+
+// GenerateRunDockerfileFromTemplate renders a run Dockerfile template,
+// either the embedded one or one provided by the builder.
+func GenerateRunDockerfileFromTemplate(templateString string, runProps structs.RunDockerfileProps) (result string, Error error) {
 
-	result, err := fillPropsToTemplate(runProps, runDockerfileTemplate)
+	if runProps.PACKAGE_MANAGER == (structs.PackageManagerCommands{}) {
+		runProps.PACKAGE_MANAGER = MICRODNF.Commands()
+	}
+
+	if err := ValidateRunDockerfileProps(runProps); err != nil {
+		return "", err
+	}
+
+	result, err := fillPropsToTemplate(runProps, templateString)
 
 	if err != nil {
 		return "", err
@@ -215,7 +508,7 @@ func GenerateRunDockerfile(runProps structs.RunDockerfileProps) (result string,
 
 func fillPropsToTemplate(properties interface{}, templateString string) (result string, Error error) {
 
-	templ, err := template.New("template").Parse(templateString)
+	templ, err := template.New("template").Funcs(template.FuncMap{"quote": quoteDockerfileString}).Parse(templateString)
 	if err != nil {
 		return "", err
 	}
@@ -223,8 +516,73 @@ func fillPropsToTemplate(properties interface{}, templateString string) (result
 	var buf bytes.Buffer
 	err = templ.Execute(&buf, properties)
 	if err != nil {
-		panic(err)
+		return "", err
 	}
 
 	return buf.String(), nil
 }
+
+// GetCACertificatesFromBindings reads the certificates of the ca-certificates
+// bindings, encoded so they can be written to the trust store of the build image.
+func GetCACertificatesFromBindings(platformDir string) ([]structs.CACertificate, error) {
+	bindings, err := servicebindings.NewResolver().Resolve("ca-certificates", "", platformDir)
+	if err != nil {
+		return []structs.CACertificate{}, err
+	}
+
+	caCertificates := []structs.CACertificate{}
+	invalidFileNameCharacters := regexp.MustCompile(`[^A-Za-z0-9._-]`)
+	for _, binding := range bindings {
+		for _, entryName := range slices.Sorted(maps.Keys(binding.Entries)) {
+			content, err := binding.Entries[entryName].ReadBytes()
+			if err != nil {
+				return []structs.CACertificate{}, err
+			}
+
+			if block, _ := pem.Decode(content); block == nil || block.Type != "CERTIFICATE" {
+				return []structs.CACertificate{}, fmt.Errorf("entry %s of binding %s is not a PEM encoded certificate", entryName, binding.Name)
+			}
+
+			caCertificates = append(caCertificates, structs.CACertificate{
+				Name:    invalidFileNameCharacters.ReplaceAllString(fmt.Sprintf("%s-%s", binding.Name, entryName), "_"),
+				Content: base64.StdEncoding.EncodeToString(content),
+			})
+		}
+	}
+
+	return caCertificates, nil
+}
+
+// GetBooleanEnv parses a true/false environment variable, defaulting to false
+// when it is not set.
+func GetBooleanEnv(name string) (bool, error) {
+	value, found := os.LookupEnv(name)
+	if !found || value == "" {
+		return false, nil
+	}
+
+	parsedValue, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid value %q for %s, expected true or false", value, name)
+	}
+
+	return parsedValue, nil
+}
+
+// quoteDockerfileString wraps a value in double quotes, escaping the characters
+// that Dockerfile instructions like LABEL would otherwise interpret.
+func quoteDockerfileString(value string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, `$`, `\$`).Replace(value) + `"`
+}
+
+// WriteGenerateReport writes the generate report as a toml file of the output
+// directory, next to the generated Dockerfiles.
+func WriteGenerateReport(outputDir string, report structs.GenerateReport) error {
+	file, err := os.Create(filepath.Join(outputDir, constants.GENERATE_REPORT_FILENAME))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return toml.NewEncoder(file).Encode(report)
+}
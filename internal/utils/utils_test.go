@@ -2,12 +2,15 @@ package utils_test
 
 import (
 	_ "embed"
+	"encoding/base64"
 	"fmt"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	. "github.com/onsi/gomega"
+	"github.com/paketo-buildpacks/packit/v2"
 	ubinodejsextension "github.com/paketo-buildpacks/ubi-nodejs-extension"
 	"github.com/paketo-buildpacks/ubi-nodejs-extension/constants"
 	testhelpers "github.com/paketo-buildpacks/ubi-nodejs-extension/internal/testhelpers"
@@ -39,7 +42,7 @@ func testGenerateConfigTomlContentFromImagesJson(t *testing.T, context spec.G, i
 			imagesJsonPath := filepath.Join(imagesJsonTmpDir, "images.json")
 			Expect(os.WriteFile(imagesJsonPath, []byte(imagesJsonContent), 0644)).To(Succeed())
 
-			configTomlContent, err := utils.GenerateConfigTomlContentFromImagesJson(imagesJsonPath, "io.buildpacks.stacks.ubix")
+			configTomlContent, err := utils.GenerateConfigTomlContentFromImagesJson(imagesJsonPath, "io.buildpacks.stacks.ubix", "linux/amd64", "8", "20")
 
 			Expect(err).ToNot(HaveOccurred())
 			Expect(string(configTomlContent)).To(ContainSubstring(`[metadata]
@@ -66,17 +69,72 @@ func testGenerateConfigTomlContentFromImagesJson(t *testing.T, context spec.G, i
 		})
 	})
 
+	context("When no default version is needed", func() {
+
+		it("leaves the default version out of the config.toml content", func() {
+			imagesJsonPath := filepath.Join(imagesJsonDir, "images.json")
+			Expect(os.WriteFile(imagesJsonPath, []byte(`{
+  "images": [
+    { "name": "nodejs-18", "is_default_run_image": true, "platforms": ["linux/amd64"] },
+    { "name": "nodejs-20", "platforms": ["linux/amd64", "linux/arm64"] }
+  ]
+}`), 0644)).To(Succeed())
+
+			configTomlContent, err := utils.GenerateConfigTomlContentFromImagesJson(imagesJsonPath, "io.buildpacks.stacks.ubix", "linux/arm64", "8", "")
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(configTomlContent)).NotTo(ContainSubstring("default-versions"))
+			Expect(string(configTomlContent)).To(ContainSubstring(`version = "20.1000"`))
+		})
+	})
+
+	context("When a default version policy is given", func() {
+
+		it("selects the default version among the stacks of the platform", func() {
+			imagesJsonPath := filepath.Join(imagesJsonDir, "images.json")
+			Expect(os.WriteFile(imagesJsonPath, []byte(`{
+  "images": [
+    { "name": "nodejs-18", "is_default_run_image": true },
+    { "name": "nodejs-20", "platforms": ["linux/amd64", "linux/arm64"] },
+    { "name": "nodejs-22", "platforms": ["linux/amd64"] }
+  ]
+}`), 0644)).To(Succeed())
+
+			defaultNodeVersion, err := utils.GetDefaultNodeVersionForPlatform(imagesJsonPath, "linux/arm64", "8", "latest", time.Date(2025, time.March, 1, 0, 0, 0, 0, time.UTC))
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(defaultNodeVersion).To(Equal("20"))
+		})
+	})
+
 	context("When GenerateConfigTomlContentFromImagesJson is being called with an invalide images.json file ", func() {
 
 		it("It should throw an error with a message", func() {
 
-			_, err := utils.GenerateConfigTomlContentFromImagesJson("/path/to/invalid/images.json", "io.buildpacks.stacks.ubix")
+			_, err := utils.GenerateConfigTomlContentFromImagesJson("/path/to/invalid/images.json", "io.buildpacks.stacks.ubix", "linux/amd64", "8", "")
 
 			Expect(err).To(HaveOccurred())
 			Expect(err.Error()).To(ContainSubstring("no such file or directory"))
 		})
 	})
 
+	context("When the default node.js version is not offered for the platform", func() {
+
+		it("It should throw an error with a message", func() {
+			imagesJsonPath := filepath.Join(imagesJsonDir, "images.json")
+			Expect(os.WriteFile(imagesJsonPath, []byte(`{
+  "images": [
+    { "name": "nodejs-18", "is_default_run_image": true, "platforms": ["linux/amd64"] },
+    { "name": "nodejs-20", "platforms": ["linux/amd64", "linux/arm64"] }
+  ]
+}`), 0644)).To(Succeed())
+
+			_, err := utils.GetDefaultNodeVersionForPlatform(imagesJsonPath, "linux/arm64", "8", "builder-default", time.Date(2025, time.March, 1, 0, 0, 0, 0, time.UTC))
+
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(Equal("default node.js version 18 is not offered for platform linux/arm64"))
+		})
+	})
 }
 func testGetDefaultNodeVersion(t *testing.T, context spec.G, it spec.S) {
 
@@ -175,7 +233,7 @@ func testCreateConfigTomlFileContent(t *testing.T, context spec.G, it spec.S) {
 					IsDefaultRunImage: false,
 					NodeVersion:       "20",
 				},
-			}, "io.buildpacks.stacks.ubix")
+			}, "io.buildpacks.stacks.ubix", "linux/amd64")
 
 			Expect(err).ToNot(HaveOccurred())
 			Expect(configTomlFileContent.String()).To(ContainSubstring(`[metadata]
@@ -195,6 +253,173 @@ func testCreateConfigTomlFileContent(t *testing.T, context spec.G, it spec.S) {
     version = "20.1000"`))
 		})
 	})
+
+	context("When a stack declares a run image for the platform", func() {
+
+		it("uses it as the source of the dependency", func() {
+			configTomlFileContent, err := utils.CreateConfigTomlFileContent("22", []utils.StackImages{
+				{
+					Name:              "nodejs-22",
+					IsDefaultRunImage: true,
+					NodeVersion:       "22",
+					Platforms:         []string{"linux/amd64", "linux/arm64"},
+					RunImages:         map[string]string{"linux/arm64": "registry.example.com/run-nodejs-22-ubi-base-arm64"},
+				},
+			}, "io.buildpacks.stacks.ubix", "linux/arm64")
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(configTomlFileContent.String()).To(ContainSubstring(`source = "registry.example.com/run-nodejs-22-ubi-base-arm64"`))
+		})
+	})
+}
+
+func testFilterStackImagesByPlatform(t *testing.T, context spec.G, it spec.S) {
+
+	var (
+		Expect = NewWithT(t).Expect
+	)
+
+	stacks := []utils.StackImages{
+		{
+			Name:        "nodejs-18",
+			NodeVersion: "18",
+		},
+		{
+			Name:        "nodejs-20",
+			NodeVersion: "20",
+			Platforms:   []string{"linux/amd64", "linux/arm64"},
+		},
+		{
+			Name:        "nodejs-22",
+			NodeVersion: "22",
+			Platforms:   []string{"linux/amd64"},
+		},
+	}
+
+	context("When stacks are offered for the platform", func() {
+
+		it("should return the stacks without platforms and the ones declaring it", func() {
+			platformStacks, err := utils.FilterStackImagesByPlatform(stacks, "linux/arm64")
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(platformStacks).To(Equal([]utils.StackImages{stacks[0], stacks[1]}))
+		})
+	})
+
+	context("When no stack is offered for the platform", func() {
+
+		it("should error with a message", func() {
+			platformStacks, err := utils.FilterStackImagesByPlatform(stacks[1:], "linux/s390x")
+
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(Equal("no nodejs stacks offered for platform linux/s390x"))
+			Expect(platformStacks).To(Equal([]utils.StackImages{}))
+		})
+	})
+}
+
+func testIsNodeRequiredAtLaunch(t *testing.T, context spec.G, it spec.S) {
+
+	var (
+		Expect = NewWithT(t).Expect
+	)
+
+	it("should require Node.js at launch when no entry tells otherwise", func() {
+		Expect(utils.IsNodeRequiredAtLaunch([]packit.BuildpackPlanEntry{
+			{Name: "node", Metadata: map[string]interface{}{"version": "20.*"}},
+		})).To(BeTrue())
+	})
+
+	it("should require Node.js at launch when an entry requests it", func() {
+		Expect(utils.IsNodeRequiredAtLaunch([]packit.BuildpackPlanEntry{
+			{Name: "node", Metadata: map[string]interface{}{"build": true}},
+			{Name: "node", Metadata: map[string]interface{}{"launch": true}},
+		})).To(BeTrue())
+	})
+
+	it("should not require Node.js at launch when it is only requested at build time", func() {
+		Expect(utils.IsNodeRequiredAtLaunch([]packit.BuildpackPlanEntry{
+			{Name: "node", Metadata: map[string]interface{}{"version": "20.*", "build": true}},
+			{Name: "node", Metadata: map[string]interface{}{"build": true, "launch": false}},
+			{Name: "npm", Metadata: map[string]interface{}{"launch": true}},
+		})).To(BeFalse())
+	})
+}
+
+func testGetTargetStack(t *testing.T, context spec.G, it spec.S) {
+
+	var (
+		Expect = NewWithT(t).Expect
+	)
+
+	it("should keep the stack exposed by the platform", func() {
+		Expect(utils.GetTargetStack("io.buildpacks.stacks.ubi8")).To(Equal("io.buildpacks.stacks.ubi8"))
+	})
+
+	it("should match any stack when the platform only exposes targets", func() {
+		Expect(utils.GetTargetStack("")).To(Equal("*"))
+
+		configTomlFileContent, err := utils.CreateConfigTomlFileContent("20", []utils.StackImages{
+			{
+				Name:              "nodejs-20",
+				IsDefaultRunImage: true,
+				NodeVersion:       "20",
+			},
+		}, utils.GetTargetStack(""), "linux/amd64")
+
+		Expect(err).ToNot(HaveOccurred())
+		Expect(configTomlFileContent.String()).To(ContainSubstring(`stacks = ["*"]`))
+	})
+
+	it("should describe the target", func() {
+		Expect(utils.GetTargetDescription("linux/arm64", structs.Distro{Name: "rhel", Version: "9.4"})).To(Equal("linux/arm64 rhel 9.4"))
+		Expect(utils.GetTargetDescription("linux/arm64", structs.Distro{})).To(Equal("linux/arm64"))
+	})
+}
+
+func testFilterStackImagesByDistroVersion(t *testing.T, context spec.G, it spec.S) {
+
+	var (
+		Expect = NewWithT(t).Expect
+	)
+
+	stacks := []utils.StackImages{
+		{
+			Name:        "nodejs-18",
+			NodeVersion: "18",
+		},
+		{
+			Name:          "nodejs-20-ubi9",
+			NodeVersion:   "20",
+			DistroVersion: "9",
+		},
+		{
+			Name:          "nodejs-22-ubi10",
+			NodeVersion:   "22",
+			DistroVersion: "10",
+		},
+	}
+
+	context("When stacks are offered for the UBI version", func() {
+
+		it("should return the stacks without distro version and the ones declaring it", func() {
+			distroStacks, err := utils.FilterStackImagesByDistroVersion(stacks, "9")
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(distroStacks).To(Equal([]utils.StackImages{stacks[0], stacks[1]}))
+		})
+	})
+
+	context("When no stack is offered for the UBI version", func() {
+
+		it("should error with a message", func() {
+			distroStacks, err := utils.FilterStackImagesByDistroVersion(stacks[1:], "8")
+
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(Equal("no nodejs stacks offered for UBI 8"))
+			Expect(distroStacks).To(Equal([]utils.StackImages{}))
+		})
+	})
 }
 
 func testParseImagesJsonFile(t *testing.T, _ spec.G, it spec.S) {
@@ -358,6 +583,46 @@ func testGetNodejsStackImages(t *testing.T, context spec.G, it spec.S) {
 		})
 	})
 
+	context("When the stack name has a suffix after the node version", func() {
+
+		it("should return it as the variant of the stack", func() {
+			nodejsStacks, err := utils.GetNodejsStackImages(utils.ImagesJson{
+				StackImages: []utils.StackImages{
+					{
+						Name:              "nodejs-20-minimal",
+						IsDefaultRunImage: true,
+					},
+				},
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(nodejsStacks).To(Equal([]utils.StackImages{
+				{
+					Name:              "nodejs-20-minimal",
+					IsDefaultRunImage: true,
+					NodeVersion:       "20",
+					Variant:           "minimal",
+				},
+			}))
+		})
+	})
+
+	context("When the stack name has no node version", func() {
+
+		it("should return an error instead of panicking", func() {
+			nodejsStacks, err := utils.GetNodejsStackImages(utils.ImagesJson{
+				StackImages: []utils.StackImages{
+					{
+						Name:              "nodejs",
+						IsDefaultRunImage: true,
+					},
+				},
+			})
+			Expect(err).To(MatchError("extracted Node.js version [] for stack nodejs is not an integer"))
+			Expect(nodejsStacks).To(Equal([]utils.StackImages{}))
+		})
+	})
+
 	context("When node version is malformed or does not exist", func() {
 
 		it("should error with a message", func() {
@@ -396,6 +661,100 @@ func testGetNodejsStackImages(t *testing.T, context spec.G, it spec.S) {
 	})
 }
 
+func testValidateImagesJson(t *testing.T, context spec.G, it spec.S) {
+
+	var (
+		Expect = NewWithT(t).Expect
+	)
+
+	context("When the nodejs stacks are consistent", func() {
+
+		it("should not report any problem", func() {
+			problems := utils.ValidateImagesJson(utils.ImagesJson{StackImages: []utils.StackImages{
+				{
+					Name:              "nodejs-20",
+					IsDefaultRunImage: true,
+				},
+				{
+					Name:              "nodejs-22",
+					IsDefaultRunImage: false,
+				},
+			}})
+
+			Expect(problems).To(BeEmpty())
+		})
+	})
+
+	context("When the nodejs stacks are not consistent", func() {
+
+		it("should report every problem found", func() {
+			problems := utils.ValidateImagesJson(utils.ImagesJson{StackImages: []utils.StackImages{
+				{
+					Name:              "nodejs-20",
+					IsDefaultRunImage: true,
+				},
+				{
+					Name:              "nodejs-20-minimal",
+					IsDefaultRunImage: true,
+				},
+				{
+					Name:              "nodejs-Latest",
+					IsDefaultRunImage: false,
+				},
+			}})
+
+			Expect(problems).To(HaveLen(3))
+			Expect(problems[0].Error()).To(Equal("extracted Node.js version [Latest] for stack nodejs-Latest is not an integer"))
+			Expect(problems[1].Error()).To(Equal("multiple default node.js versions found"))
+			Expect(problems[2].Error()).To(Equal("node.js version 20 is declared by multiple stacks: nodejs-20, nodejs-20-minimal"))
+		})
+
+		it("should report platforms and run images declared incorrectly", func() {
+			problems := utils.ValidateImagesJson(utils.ImagesJson{StackImages: []utils.StackImages{
+				{
+					Name:              "nodejs-20",
+					IsDefaultRunImage: true,
+					Platforms:         []string{"arm64"},
+					RunImages:         map[string]string{"linux/arm64": "registry.example.com/run-nodejs-20-ubi-base-arm64"},
+				},
+				{
+					Name:      "nodejs-22",
+					RunImages: map[string]string{"linux/ppc64le": "Registry.example.com/Run-Nodejs-22"},
+				},
+			}})
+
+			Expect(problems).To(HaveLen(3))
+			Expect(problems[0].Error()).To(Equal("platform [arm64] for stack nodejs-20 is not in the os/arch format"))
+			Expect(problems[1].Error()).To(Equal("run image for platform linux/arm64 of stack nodejs-20 is not part of its platforms"))
+			Expect(problems[2].Error()).To(ContainSubstring("run image reference [Registry.example.com/Run-Nodejs-22] for platform linux/ppc64le of stack nodejs-22 is not valid"))
+		})
+
+		it("should check the default and duplicated versions per UBI version", func() {
+			problems := utils.ValidateImagesJson(utils.ImagesJson{StackImages: []utils.StackImages{
+				{
+					Name:              "nodejs-20",
+					IsDefaultRunImage: true,
+					DistroVersion:     "8",
+				},
+				{
+					Name:              "nodejs-20-ubi9",
+					IsDefaultRunImage: false,
+					DistroVersion:     "9",
+				},
+				{
+					Name:              "nodejs-20-ubi9-minimal",
+					IsDefaultRunImage: false,
+					DistroVersion:     "9",
+				},
+			}})
+
+			Expect(problems).To(HaveLen(2))
+			Expect(problems[0].Error()).To(Equal("default node.js version not found for UBI 9"))
+			Expect(problems[1].Error()).To(Equal("node.js version 20 on UBI 9 is declared by multiple stacks: nodejs-20-ubi9, nodejs-20-ubi9-minimal"))
+		})
+	})
+}
+
 func testGenerateBuildDockerfile(t *testing.T, context spec.G, it spec.S) {
 
 	var (
@@ -433,6 +792,154 @@ RUN echo "CNB_STACK_ID: io.buildpacks.stacks.ubi8"`, ubinodejsextension.PACKAGES
 
 		})
 
+		it("Should add the CA certificates to the trust store before installing packages", func() {
+
+			output, err := utils.GenerateBuildDockerfile(structs.BuildDockerfileProps{
+				NODEJS_VERSION: 20,
+				CNB_USER_ID:    1000,
+				CNB_GROUP_ID:   1000,
+				CNB_STACK_ID:   "io.buildpacks.stacks.ubi8",
+				PACKAGES:       "nodejs npm",
+				CA_CERTIFICATES: []structs.CACertificate{
+					{Name: "my-ca-ca.pem", Content: "Y2VydGlmaWNhdGU="},
+				},
+			})
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(output).To(ContainSubstring(`RUN echo ${build_id}
+
+RUN echo Y2VydGlmaWNhdGU= | base64 -d > /etc/pki/ca-trust/source/anchors/my-ca-ca.pem
+RUN update-ca-trust extract
+ENV NODE_EXTRA_CA_CERTS=/etc/pki/tls/certs/ca-bundle.crt
+
+RUN microdnf -y module enable nodejs:20`))
+		})
+
+		it("Should not enable the nodejs module stream when Node.js is not modular", func() {
+
+			output, err := utils.GenerateBuildDockerfile(structs.BuildDockerfileProps{
+				NODEJS_VERSION: 24,
+				CNB_USER_ID:    1000,
+				CNB_GROUP_ID:   1000,
+				CNB_STACK_ID:   "io.buildpacks.stacks.ubi10",
+				PACKAGES:       "nodejs24 nodejs24-npm",
+				NON_MODULAR:    true,
+			})
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(output).NotTo(ContainSubstring("module enable"))
+			Expect(output).To(ContainSubstring(`RUN echo ${build_id}
+
+RUN microdnf --setopt=install_weak_deps=0 --setopt=tsflags=nodocs install -y nodejs24 nodejs24-npm && microdnf clean all`))
+		})
+
+		it("Should only install the missing packages when Node.js is already installed", func() {
+
+			output, err := utils.GenerateBuildDockerfile(structs.BuildDockerfileProps{
+				NODEJS_VERSION:   20,
+				CNB_USER_ID:      1000,
+				CNB_GROUP_ID:     1000,
+				CNB_STACK_ID:     "io.buildpacks.stacks.ubi8",
+				PACKAGES:         "python3",
+				NODEJS_INSTALLED: true,
+			})
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(output).NotTo(ContainSubstring("module enable"))
+			Expect(output).To(ContainSubstring(`RUN echo ${build_id}
+
+RUN microdnf --setopt=install_weak_deps=0 --setopt=tsflags=nodocs install -y python3 && microdnf clean all
+
+RUN echo uid:gid "1000:1000"`))
+		})
+
+		it("Should not install anything when Node.js and the packages are already installed", func() {
+
+			output, err := utils.GenerateBuildDockerfile(structs.BuildDockerfileProps{
+				NODEJS_VERSION:   20,
+				CNB_USER_ID:      1000,
+				CNB_GROUP_ID:     1000,
+				CNB_STACK_ID:     "io.buildpacks.stacks.ubi8",
+				NODEJS_INSTALLED: true,
+			})
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(output).NotTo(ContainSubstring("microdnf"))
+		})
+
+		it("Should use the commands of the given package manager", func() {
+
+			output, err := utils.GenerateBuildDockerfile(structs.BuildDockerfileProps{
+				NODEJS_VERSION:  20,
+				CNB_USER_ID:     1000,
+				CNB_GROUP_ID:    1000,
+				CNB_STACK_ID:    "io.buildpacks.stacks.ubi8",
+				PACKAGES:        "nodejs npm",
+				PACKAGE_MANAGER: utils.DNF.Commands(),
+			})
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(output).NotTo(ContainSubstring("microdnf"))
+			Expect(output).To(ContainSubstring(`RUN dnf -y module enable nodejs:20
+RUN dnf --setopt=install_weak_deps=0 --setopt=tsflags=nodocs install -y nodejs npm && dnf clean all`))
+		})
+
+		it("Should install the requested profile of the nodejs module stream", func() {
+
+			output, err := utils.GenerateBuildDockerfile(structs.BuildDockerfileProps{
+				NODEJS_VERSION: 20,
+				CNB_USER_ID:    1000,
+				CNB_GROUP_ID:   1000,
+				CNB_STACK_ID:   "io.buildpacks.stacks.ubi8",
+				PACKAGES:       "nodejs npm",
+				NODEJS_PROFILE: "minimal",
+			})
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(output).To(ContainSubstring(`RUN microdnf -y module enable nodejs:20
+RUN microdnf --setopt=install_weak_deps=0 --setopt=tsflags=nodocs install -y @nodejs:20/minimal && microdnf clean all
+RUN microdnf --setopt=install_weak_deps=0 --setopt=tsflags=nodocs install -y nodejs npm && microdnf clean all`))
+		})
+
+		it("Should enable the FIPS crypto policy when FIPS is requested", func() {
+
+			output, err := utils.GenerateBuildDockerfile(structs.BuildDockerfileProps{
+				NODEJS_VERSION: 20,
+				CNB_USER_ID:    1000,
+				CNB_GROUP_ID:   1000,
+				CNB_STACK_ID:   "io.buildpacks.stacks.ubi8",
+				PACKAGES:       "nodejs npm crypto-policies-scripts",
+				FIPS:           true,
+			})
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(output).To(ContainSubstring(`RUN microdnf --setopt=install_weak_deps=0 --setopt=tsflags=nodocs install -y nodejs npm crypto-policies-scripts && microdnf clean all
+
+RUN update-crypto-policies --set FIPS
+ENV NODE_OPTIONS="--use-openssl-ca --enable-fips"
+
+RUN echo uid:gid "1000:1000"`))
+		})
+
+		it("Should point Node.js to the full ICU data when it is requested", func() {
+
+			output, err := utils.GenerateBuildDockerfile(structs.BuildDockerfileProps{
+				NODEJS_VERSION: 20,
+				CNB_USER_ID:    1000,
+				CNB_GROUP_ID:   1000,
+				CNB_STACK_ID:   "io.buildpacks.stacks.ubi8",
+				PACKAGES:       "nodejs npm nodejs-full-i18n",
+				FULL_ICU:       true,
+			})
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(output).To(ContainSubstring(`RUN microdnf --setopt=install_weak_deps=0 --setopt=tsflags=nodocs install -y nodejs npm nodejs-full-i18n && microdnf clean all
+
+ENV NODE_ICU_DATA=/usr/share/nodejs/icudata
+
+RUN echo uid:gid "1000:1000"`))
+		})
+
 	})
 }
 
@@ -456,6 +963,223 @@ func testGenerateRunDockerfile(t *testing.T, context spec.G, it spec.S) {
 			Expect(output).To(Equal(`FROM paketocommunity/run-nodejs-18-ubi-base`))
 
 		})
+
+		it("Should add the labels quoted to the template/run.Dockerfile", func() {
+
+			RunDockerfileProps := structs.RunDockerfileProps{
+				Source: "paketocommunity/run-nodejs-18-ubi-base",
+				Labels: map[string]string{
+					"io.paketo.b": `{"key":"$value"}`,
+					"io.paketo.a": "value",
+				},
+			}
+
+			output, err := utils.GenerateRunDockerfile(RunDockerfileProps)
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(output).To(Equal(`FROM paketocommunity/run-nodejs-18-ubi-base
+LABEL io.paketo.a="value"
+LABEL io.paketo.b="{\"key\":\"\$value\"}"`))
+
+		})
+
+		it("Should enable the FIPS crypto policy on the run image when FIPS is requested", func() {
+
+			output, err := utils.GenerateRunDockerfile(structs.RunDockerfileProps{
+				Source:       "paketocommunity/run-nodejs-18-ubi-base",
+				CNB_USER_ID:  1002,
+				CNB_GROUP_ID: 1000,
+				FIPS:         true,
+				PACKAGES:     "crypto-policies-scripts",
+			})
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(output).To(Equal(`FROM paketocommunity/run-nodejs-18-ubi-base
+
+USER root
+RUN microdnf --setopt=install_weak_deps=0 --setopt=tsflags=nodocs install -y crypto-policies-scripts && microdnf clean all
+RUN update-crypto-policies --set FIPS
+ENV NODE_OPTIONS="--use-openssl-ca --enable-fips"
+USER 1002:1000`))
+		})
+
+		it("Should point Node.js to the full ICU data on the run image when it is requested", func() {
+
+			output, err := utils.GenerateRunDockerfile(structs.RunDockerfileProps{
+				Source:       "paketocommunity/run-nodejs-18-ubi-base",
+				CNB_USER_ID:  1002,
+				CNB_GROUP_ID: 1000,
+				FULL_ICU:     true,
+				PACKAGES:     "nodejs-full-i18n",
+			})
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(output).To(Equal(`FROM paketocommunity/run-nodejs-18-ubi-base
+
+USER root
+RUN microdnf --setopt=install_weak_deps=0 --setopt=tsflags=nodocs install -y nodejs-full-i18n && microdnf clean all
+ENV NODE_ICU_DATA=/usr/share/nodejs/icudata
+USER 1002:1000`))
+		})
+	})
+}
+
+func testGetCACertificatesFromBindings(t *testing.T, context spec.G, it spec.S) {
+
+	var (
+		Expect      = NewWithT(t).Expect
+		platformDir string
+		certificate = "-----BEGIN CERTIFICATE-----\nMIIB\n-----END CERTIFICATE-----\n"
+	)
+
+	it.Before(func() {
+		platformDir = t.TempDir()
+		t.Setenv("SERVICE_BINDING_ROOT", "")
+		t.Setenv("CNB_BINDINGS", "")
+	})
+
+	context("When there are no bindings", func() {
+
+		it("It should return no certificates", func() {
+			caCertificates, err := utils.GetCACertificatesFromBindings(platformDir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(caCertificates).To(BeEmpty())
+		})
+	})
+
+	context("When there is a ca-certificates binding", func() {
+
+		it.Before(func() {
+			bindingDir := filepath.Join(platformDir, "bindings", "my-ca")
+			Expect(os.MkdirAll(bindingDir, 0755)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(bindingDir, "type"), []byte("ca-certificates"), 0600)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(bindingDir, "root ca.pem"), []byte(certificate), 0600)).To(Succeed())
+		})
+
+		it("It should return its certificates base64 encoded", func() {
+			caCertificates, err := utils.GetCACertificatesFromBindings(platformDir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(caCertificates).To(Equal([]structs.CACertificate{
+				{
+					Name:    "my-ca-root_ca.pem",
+					Content: base64.StdEncoding.EncodeToString([]byte(certificate)),
+				},
+			}))
+		})
+
+		it("It should error when an entry is not a certificate", func() {
+			Expect(os.WriteFile(filepath.Join(platformDir, "bindings", "my-ca", "README"), []byte("not a certificate"), 0600)).To(Succeed())
+
+			_, err := utils.GetCACertificatesFromBindings(platformDir)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(Equal("entry README of binding my-ca is not a PEM encoded certificate"))
+		})
+	})
+}
+
+func testGetBooleanEnv(t *testing.T, context spec.G, it spec.S) {
+
+	var (
+		Expect = NewWithT(t).Expect
+	)
+
+	context("When the env variable is not set", func() {
+
+		it("It should return false", func() {
+			value, err := utils.GetBooleanEnv("BP_SOME_BOOLEAN")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(value).To(BeFalse())
+		})
+	})
+
+	context("When the env variable is set to a boolean", func() {
+
+		it("It should return its value", func() {
+			t.Setenv("BP_SOME_BOOLEAN", "true")
+
+			value, err := utils.GetBooleanEnv("BP_SOME_BOOLEAN")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(value).To(BeTrue())
+		})
+	})
+
+	context("When the env variable is NOT set to a boolean", func() {
+
+		it("It should return an error", func() {
+			t.Setenv("BP_SOME_BOOLEAN", "yes please")
+
+			_, err := utils.GetBooleanEnv("BP_SOME_BOOLEAN")
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(Equal(`invalid value "yes please" for BP_SOME_BOOLEAN, expected true or false`))
+		})
+	})
+}
+
+func testWriteGenerateReport(t *testing.T, context spec.G, it spec.S) {
+
+	var (
+		Expect = NewWithT(t).Expect
+	)
+
+	context("When the output directory exists", func() {
+
+		it("It should write the report as a toml file", func() {
+			outputDir := t.TempDir()
+
+			err := utils.WriteGenerateReport(outputDir, structs.GenerateReport{
+				NodeRequestedVersion: "~18",
+				NodeVersionSource:    "BP_NODE_VERSION",
+				NodeMajorVersion:     18,
+				NodeProfile:          "minimal",
+				NodeLaunch:           true,
+				RunImage:             "paketocommunity/run-nodejs-18-ubi-base",
+				RunImageSource:       "images.json",
+				Packages:             []string{"nodejs", "npm"},
+				ImagesJsonPath:       "/etc/buildpacks/images.json",
+				Platform:             "linux/amd64",
+				Distro:               "rhel",
+				DistroVersion:        "8",
+				PackageManager:       "microdnf",
+				BuildTemplate:        "embedded",
+				RunTemplate:          "embedded",
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			content, err := os.ReadFile(filepath.Join(outputDir, "generate-report.toml"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(content)).To(Equal(`node-requested-version = "~18"
+node-version-source = "BP_NODE_VERSION"
+default-version-policy = ""
+node-version-fallback = ""
+node-major-version = 18
+node-profile = "minimal"
+node-launch = true
+node-preinstalled = false
+npm-version = ""
+npm-version-source = ""
+run-image = "paketocommunity/run-nodejs-18-ubi-base"
+run-image-source = "images.json"
+packages = ["nodejs", "npm"]
+images-json-path = "/etc/buildpacks/images.json"
+platform = "linux/amd64"
+distro = "rhel"
+distro-version = "8"
+package-manager = "microdnf"
+build-template = "embedded"
+run-template = "embedded"
+fips = false
+full-icu = false
+`))
+		})
+	})
+
+	context("When the output directory does NOT exist", func() {
+
+		it("It should return an error", func() {
+			err := utils.WriteGenerateReport("/path/does/not/exist", structs.GenerateReport{})
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("no such file or directory"))
+		})
 	})
 }
 
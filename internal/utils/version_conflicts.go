@@ -0,0 +1,74 @@
+package utils
+
+import (
+	"fmt"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/paketo-buildpacks/packit/v2"
+)
+
+// VersionConflict is a Node.js version requested by a lower priority source
+// which is not satisfied by the selected major version.
+type VersionConflict struct {
+	Version, VersionSource string
+}
+
+func (conflict VersionConflict) String() string {
+	return fmt.Sprintf("%s requests %s", conflict.VersionSource, conflict.Version)
+}
+
+// GetVersionConflicts returns the candidates, the highest priority one
+// excepted, whose version does not allow the selected major version. The
+// versions which are not semver constraints can not conflict.
+func GetVersionConflicts(candidates []packit.BuildpackPlanEntry, selectedMajorVersion uint64) []VersionConflict {
+	conflicts := []VersionConflict{}
+	for i, candidate := range candidates {
+		constraint, ok := getCandidateConstraint(candidate)
+		if i == 0 || !ok || allowsMajorVersion(constraint, selectedMajorVersion) {
+			continue
+		}
+
+		version, _ := candidate.Metadata["version"].(string)
+		versionSource, _ := candidate.Metadata["version-source"].(string)
+		if versionSource == "" {
+			versionSource = "unknown source"
+		}
+		conflicts = append(conflicts, VersionConflict{Version: version, VersionSource: versionSource})
+	}
+
+	return conflicts
+}
+
+// GetMajorVersionsSatisfyingAll returns the offered major versions allowed by
+// the versions of every candidate.
+func GetMajorVersionsSatisfyingAll(candidates []packit.BuildpackPlanEntry, offeredMajorVersions []uint64) []uint64 {
+	majorVersions := []uint64{}
+	for _, majorVersion := range offeredMajorVersions {
+		satisfiesAll := true
+		for _, candidate := range candidates {
+			if constraint, ok := getCandidateConstraint(candidate); ok && !allowsMajorVersion(constraint, majorVersion) {
+				satisfiesAll = false
+				break
+			}
+		}
+		if satisfiesAll {
+			majorVersions = append(majorVersions, majorVersion)
+		}
+	}
+
+	return majorVersions
+}
+
+func getCandidateConstraint(candidate packit.BuildpackPlanEntry) (*semver.Constraints, bool) {
+	version, _ := candidate.Metadata["version"].(string)
+	if version == "" {
+		return nil, false
+	}
+
+	constraint, err := semver.NewConstraint(version)
+	if err != nil {
+		return nil, false
+	}
+
+	return constraint, true
+}
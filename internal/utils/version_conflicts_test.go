@@ -0,0 +1,54 @@
+package utils_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/paketo-buildpacks/packit/v2"
+	"github.com/paketo-buildpacks/ubi-nodejs-extension/internal/utils"
+	"github.com/sclevine/spec"
+)
+
+func testGetVersionConflicts(t *testing.T, context spec.G, it spec.S) {
+
+	var (
+		Expect = NewWithT(t).Expect
+	)
+
+	candidate := func(version string, versionSource string) packit.BuildpackPlanEntry {
+		return packit.BuildpackPlanEntry{
+			Name:     "node",
+			Metadata: map[string]interface{}{"version": version, "version-source": versionSource},
+		}
+	}
+
+	candidates := []packit.BuildpackPlanEntry{
+		candidate("18", ".nvmrc"),
+		candidate(">=20", "package.json"),
+		candidate("18.20.1", ".node-version"),
+		candidate("lts/*", ".tool-versions"),
+		{Name: "node"},
+	}
+
+	it("It should return the lower priority versions not allowing the selected major version", func() {
+		Expect(utils.GetVersionConflicts(candidates, 18)).To(Equal([]utils.VersionConflict{
+			{Version: ">=20", VersionSource: "package.json"},
+		}))
+		Expect(utils.GetVersionConflicts(candidates, 18)[0].String()).To(Equal("package.json requests >=20"))
+	})
+
+	it("It should not report the highest priority version", func() {
+		Expect(utils.GetVersionConflicts(candidates, 20)).To(Equal([]utils.VersionConflict{
+			{Version: "18.20.1", VersionSource: ".node-version"},
+		}))
+	})
+
+	it("It should return no conflict when the versions agree", func() {
+		Expect(utils.GetVersionConflicts(candidates[2:], 18)).To(BeEmpty())
+	})
+
+	it("It should return the major versions satisfying every candidate", func() {
+		Expect(utils.GetMajorVersionsSatisfyingAll(candidates[1:2], []uint64{18, 20, 22})).To(Equal([]uint64{20, 22}))
+		Expect(utils.GetMajorVersionsSatisfyingAll(candidates, []uint64{18, 20, 22})).To(BeEmpty())
+	})
+}
@@ -0,0 +1,120 @@
+package utils
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/semver/v3"
+)
+
+// Policies applied when the requested Node.js major version is not offered
+var VERSION_FALLBACK_POLICIES = []string{"fail", "nearest-newer", "nearest-lts"}
+
+// GetOfferedNodeMajorVersions returns the Node.js major versions of the
+// images.json file offered for the platform and the UBI version, sorted.
+func GetOfferedNodeMajorVersions(imagesJsonPath string, platform string, distroVersion string) ([]uint64, error) {
+	imagesJsonData, err := ParseImagesJsonFile(imagesJsonPath)
+	if err != nil {
+		return nil, err
+	}
+
+	nodejsStacks, err := GetNodejsStackImages(imagesJsonData)
+	if err != nil {
+		return nil, err
+	}
+
+	nodejsStacks, err = FilterStackImagesByDistroVersion(nodejsStacks, distroVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	nodejsStacks, err = FilterStackImagesByPlatform(nodejsStacks, platform)
+	if err != nil {
+		return nil, err
+	}
+
+	var majorVersions []uint64
+	for _, stack := range nodejsStacks {
+		majorVersion, err := strconv.ParseUint(stack.NodeVersion, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		if !slices.Contains(majorVersions, majorVersion) {
+			majorVersions = append(majorVersions, majorVersion)
+		}
+	}
+	slices.Sort(majorVersions)
+
+	return majorVersions, nil
+}
+
+// FormatMajorVersions lists major versions as a comma separated string.
+func FormatMajorVersions(majorVersions []uint64) string {
+	var formatted []string
+	for _, majorVersion := range majorVersions {
+		formatted = append(formatted, strconv.FormatUint(majorVersion, 10))
+	}
+
+	return strings.Join(formatted, ", ")
+}
+
+// GetFallbackNodeMajorVersion picks an offered major version replacing the one
+// requested by a version constraint. nearest-newer picks the lowest offered
+// major version above the requested one, nearest-lts the LTS major version
+// closest to it, the newer one on a tie.
+func GetFallbackNodeMajorVersion(requestedVersion string, offeredMajorVersions []uint64, policy string, date time.Time) (uint64, error) {
+	constraint, err := semver.NewConstraint(requestedVersion)
+	if err != nil {
+		return 0, fmt.Errorf("can not fall back from Node.js version %q: %w", requestedVersion, err)
+	}
+
+	requestedMajorVersion, found := uint64(0), false
+	for majorVersion := uint64(0); majorVersion < 100; majorVersion++ {
+		if allowsMajorVersion(constraint, majorVersion) {
+			requestedMajorVersion, found = majorVersion, true
+			break
+		}
+	}
+	if !found {
+		return 0, fmt.Errorf("can not fall back from Node.js version %q as it does not match any major version", requestedVersion)
+	}
+
+	switch policy {
+	case "nearest-newer":
+		for _, majorVersion := range offeredMajorVersions {
+			if majorVersion > requestedMajorVersion {
+				return majorVersion, nil
+			}
+		}
+	case "nearest-lts":
+		releases, err := GetNodejsReleases()
+		if err != nil {
+			return 0, err
+		}
+
+		var fallbackMajorVersion uint64
+		bestDistance := -1
+		for _, majorVersion := range offeredMajorVersions {
+			if !releases[strconv.FormatUint(majorVersion, 10)].IsLTS(date) {
+				continue
+			}
+			distance := int(majorVersion) - int(requestedMajorVersion)
+			if distance < 0 {
+				distance = -distance
+			}
+			if bestDistance == -1 || distance <= bestDistance {
+				fallbackMajorVersion, bestDistance = majorVersion, distance
+			}
+		}
+		if bestDistance != -1 {
+			return fallbackMajorVersion, nil
+		}
+	default:
+		return 0, fmt.Errorf("invalid version fallback policy %q, supported policies are: %s", policy, strings.Join(VERSION_FALLBACK_POLICIES, ", "))
+	}
+
+	return 0, fmt.Errorf("no Node.js version to fall back to from %q with the %s policy", requestedVersion, policy)
+}
@@ -0,0 +1,81 @@
+package utils_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"github.com/paketo-buildpacks/ubi-nodejs-extension/internal/utils"
+	"github.com/sclevine/spec"
+)
+
+func testGetOfferedNodeMajorVersions(t *testing.T, context spec.G, it spec.S) {
+
+	var (
+		Expect = NewWithT(t).Expect
+	)
+
+	it("It should return the major versions offered for the platform and the UBI version", func() {
+		imagesJsonPath := filepath.Join(t.TempDir(), "images.json")
+		Expect(os.WriteFile(imagesJsonPath, []byte(`{
+  "images": [
+    { "name": "nodejs-22", "platforms": ["linux/amd64"] },
+    { "name": "nodejs-18", "is_default_run_image": true },
+    { "name": "nodejs-20-minimal" },
+    { "name": "nodejs-20" },
+    { "name": "nodejs-24", "distro_version": "10" }
+  ]
+}`), 0644)).To(Succeed())
+
+		majorVersions, err := utils.GetOfferedNodeMajorVersions(imagesJsonPath, "linux/arm64", "8")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(majorVersions).To(Equal([]uint64{18, 20}))
+		Expect(utils.FormatMajorVersions(majorVersions)).To(Equal("18, 20"))
+	})
+}
+
+func testGetFallbackNodeMajorVersion(t *testing.T, context spec.G, it spec.S) {
+
+	var (
+		Expect               = NewWithT(t).Expect
+		offeredMajorVersions = []uint64{16, 18, 20, 22, 23}
+		date                 = time.Date(2025, time.March, 1, 0, 0, 0, 0, time.UTC)
+	)
+
+	context("When the policy is nearest-newer", func() {
+
+		it("It should return the lowest offered major version above the requested one", func() {
+			Expect(utils.GetFallbackNodeMajorVersion("19.*", offeredMajorVersions, "nearest-newer", date)).To(Equal(uint64(20)))
+			Expect(utils.GetFallbackNodeMajorVersion("~21.6.0", offeredMajorVersions, "nearest-newer", date)).To(Equal(uint64(22)))
+		})
+
+		it("It should fail when no newer major version is offered", func() {
+			_, err := utils.GetFallbackNodeMajorVersion("24", offeredMajorVersions, "nearest-newer", date)
+			Expect(err).To(MatchError(`no Node.js version to fall back to from "24" with the nearest-newer policy`))
+		})
+	})
+
+	context("When the policy is nearest-lts", func() {
+
+		it("It should return the closest LTS major version", func() {
+			Expect(utils.GetFallbackNodeMajorVersion("24.*", offeredMajorVersions, "nearest-lts", date)).To(Equal(uint64(22)))
+			Expect(utils.GetFallbackNodeMajorVersion("17", offeredMajorVersions, "nearest-lts", date)).To(Equal(uint64(18)))
+		})
+
+		it("It should prefer the newer major version on a tie", func() {
+			Expect(utils.GetFallbackNodeMajorVersion("21", offeredMajorVersions, "nearest-lts", date)).To(Equal(uint64(22)))
+		})
+
+		it("It should fail when no LTS major version is offered", func() {
+			_, err := utils.GetFallbackNodeMajorVersion("21", []uint64{16, 23}, "nearest-lts", date)
+			Expect(err).To(MatchError(`no Node.js version to fall back to from "21" with the nearest-lts policy`))
+		})
+	})
+
+	it("It should fail when the requested version is not a constraint", func() {
+		_, err := utils.GetFallbackNodeMajorVersion("lts/hydrogen", offeredMajorVersions, "nearest-newer", date)
+		Expect(err).To(MatchError(ContainSubstring(`can not fall back from Node.js version "lts/hydrogen"`)))
+	})
+}
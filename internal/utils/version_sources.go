@@ -0,0 +1,121 @@
+package utils
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/paketo-buildpacks/packit/v2"
+)
+
+// Sources of the requested Node.js version, from the highest to the lowest
+// priority. The workspaces, volta and .tool-versions sources are read by the
+// extension, the other ones come from the buildpacks requiring Node.js.
+var NODE_VERSION_SOURCES = []string{"BP_NODE_VERSION", "workspaces", "package.json", "volta", ".nvmrc", ".node-version", ".tool-versions"}
+
+// GetNodeVersionSourcePriorities returns NODE_VERSION_SOURCES as the priorities of draft.Planner.
+func GetNodeVersionSourcePriorities() []interface{} {
+	priorities := []interface{}{}
+	for _, source := range NODE_VERSION_SOURCES {
+		priorities = append(priorities, source)
+	}
+
+	return priorities
+}
+
+type packageJsonVolta struct {
+	Volta struct {
+		Node string `json:"node"`
+	} `json:"volta"`
+}
+
+// GetVoltaNodeVersion returns the Node.js version pinned by the volta.node
+// field of the package.json file.
+func GetVoltaNodeVersion(projectPath string) (string, error) {
+	content, err := os.ReadFile(filepath.Join(projectPath, "package.json"))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+
+	var packageJson packageJsonVolta
+	if err := json.Unmarshal(content, &packageJson); err != nil {
+		return "", fmt.Errorf("failed to parse package.json: %w", err)
+	}
+
+	return packageJson.Volta.Node, nil
+}
+
+// GetToolVersionsNodeVersion returns the Node.js version of the asdf
+// .tool-versions file, the first one when several are listed. The system
+// version does not request any version.
+func GetToolVersionsNodeVersion(projectPath string) (string, error) {
+	file, err := os.Open(filepath.Join(projectPath, ".tool-versions"))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		fields := strings.Fields(line)
+		if len(fields) < 2 || (fields[0] != "nodejs" && fields[0] != "node") {
+			continue
+		}
+		if fields[1] == "system" {
+			return "", nil
+		}
+		return fields[1], nil
+	}
+
+	return "", scanner.Err()
+}
+
+// GetNodeVersionFileEntries returns a node plan entry for each of the version
+// sources read by the extension which requests a Node.js version. As the
+// builder offers a single Node.js version per major, exact pins request
+// their major version.
+func GetNodeVersionFileEntries(projectPath string) ([]packit.BuildpackPlanEntry, error) {
+	voltaVersion, err := GetVoltaNodeVersion(projectPath)
+	if err != nil {
+		return nil, err
+	}
+
+	toolVersionsVersion, err := GetToolVersionsNodeVersion(projectPath)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []packit.BuildpackPlanEntry{}
+	for _, source := range []struct{ version, versionSource string }{
+		{version: voltaVersion, versionSource: "volta"},
+		{version: toolVersionsVersion, versionSource: ".tool-versions"},
+	} {
+		if source.version != "" {
+			entries = append(entries, packit.BuildpackPlanEntry{
+				Name:     "node",
+				Metadata: map[string]interface{}{"version": pinnedMajorVersion(source.version), "version-source": source.versionSource},
+			})
+		}
+	}
+
+	return entries, nil
+}
+
+func pinnedMajorVersion(version string) string {
+	pinnedVersion, err := semver.StrictNewVersion(strings.TrimPrefix(version, "v"))
+	if err != nil {
+		return version
+	}
+
+	return fmt.Sprint(pinnedVersion.Major())
+}
@@ -0,0 +1,82 @@
+package utils_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/paketo-buildpacks/packit/v2"
+	"github.com/paketo-buildpacks/ubi-nodejs-extension/internal/utils"
+	"github.com/sclevine/spec"
+)
+
+func testGetNodeVersionFileEntries(t *testing.T, context spec.G, it spec.S) {
+
+	var (
+		Expect      = NewWithT(t).Expect
+		projectPath string
+	)
+
+	it.Before(func() {
+		projectPath = t.TempDir()
+	})
+
+	context("When the project has no version file", func() {
+
+		it("It should return no entry", func() {
+			entries, err := utils.GetNodeVersionFileEntries(projectPath)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(entries).To(BeEmpty())
+		})
+	})
+
+	context("When the project pins Node.js with volta and asdf", func() {
+
+		it.Before(func() {
+			Expect(os.WriteFile(filepath.Join(projectPath, "package.json"), []byte(`{"engines": {"node": ">=18"}, "volta": {"node": "20.11.1", "npm": "10.2.4"}}`), 0644)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(projectPath, ".tool-versions"), []byte("# runtimes\npython 3.12.1\nnodejs 18.19.0 20.11.1 # for the e2e tests\n"), 0644)).To(Succeed())
+		})
+
+		it("It should return an entry for each of them", func() {
+			entries, err := utils.GetNodeVersionFileEntries(projectPath)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(entries).To(Equal([]packit.BuildpackPlanEntry{
+				{Name: "node", Metadata: map[string]interface{}{"version": "20", "version-source": "volta"}},
+				{Name: "node", Metadata: map[string]interface{}{"version": "18", "version-source": ".tool-versions"}},
+			}))
+		})
+	})
+
+	context("When the pins are not exact versions", func() {
+
+		it("It should request them as they are", func() {
+			Expect(os.WriteFile(filepath.Join(projectPath, ".tool-versions"), []byte("nodejs lts\n"), 0644)).To(Succeed())
+
+			entries, err := utils.GetNodeVersionFileEntries(projectPath)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(entries).To(Equal([]packit.BuildpackPlanEntry{
+				{Name: "node", Metadata: map[string]interface{}{"version": "lts", "version-source": ".tool-versions"}},
+			}))
+		})
+	})
+
+	context("When .tool-versions uses the system Node.js", func() {
+
+		it("It should not request any version", func() {
+			Expect(os.WriteFile(filepath.Join(projectPath, ".tool-versions"), []byte("node system\n"), 0644)).To(Succeed())
+
+			Expect(utils.GetToolVersionsNodeVersion(projectPath)).To(BeEmpty())
+		})
+	})
+
+	context("When package.json is not valid", func() {
+
+		it("It should fail", func() {
+			Expect(os.WriteFile(filepath.Join(projectPath, "package.json"), []byte(`{"volta": `), 0644)).To(Succeed())
+
+			_, err := utils.GetNodeVersionFileEntries(projectPath)
+			Expect(err).To(MatchError(ContainSubstring("failed to parse package.json")))
+		})
+	})
+}
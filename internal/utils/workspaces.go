@@ -0,0 +1,267 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+	"gopkg.in/yaml.v3"
+)
+
+// Workspace is a package of an npm, yarn or pnpm workspaces project, the
+// project root included.
+type Workspace struct {
+	// Name is the name of the package.json file, or its directory relative to the project when it has none
+	Name string
+	// NodeVersion is the engines.node range of the package.json file
+	NodeVersion string
+}
+
+type workspacePackageJson struct {
+	Name    string `json:"name"`
+	Engines struct {
+		Node string `json:"node"`
+	} `json:"engines"`
+	Workspaces json.RawMessage `json:"workspaces"`
+}
+
+type pnpmWorkspaceYaml struct {
+	Packages []string `yaml:"packages"`
+}
+
+// GetWorkspaces returns the project root followed by the workspaces matched by
+// the workspaces field of its package.json file or, for pnpm, by the packages
+// of its pnpm-workspace.yaml file. It returns nil when the project does not
+// declare any workspace.
+func GetWorkspaces(projectPath string) ([]Workspace, error) {
+	rootPackageJson, err := readWorkspacePackageJson(projectPath)
+	if err != nil || rootPackageJson == nil {
+		return nil, err
+	}
+
+	patterns, err := getWorkspacePatterns(projectPath, rootPackageJson.Workspaces)
+	if err != nil || len(patterns) == 0 {
+		return nil, err
+	}
+
+	workspaces := []Workspace{newWorkspace(".", rootPackageJson)}
+	err = filepath.WalkDir(projectPath, func(workspacePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.IsDir() || workspacePath == projectPath {
+			return nil
+		}
+		if entry.Name() == "node_modules" || strings.HasPrefix(entry.Name(), ".") {
+			return filepath.SkipDir
+		}
+
+		relativePath, err := filepath.Rel(projectPath, workspacePath)
+		if err != nil {
+			return err
+		}
+		if !mayContainWorkspaces(patterns, filepath.ToSlash(relativePath)) {
+			return filepath.SkipDir
+		}
+		if !matchesWorkspacePatterns(patterns, filepath.ToSlash(relativePath)) {
+			return nil
+		}
+
+		packageJson, err := readWorkspacePackageJson(workspacePath)
+		if err != nil {
+			return err
+		}
+		if packageJson != nil {
+			workspaces = append(workspaces, newWorkspace(filepath.ToSlash(relativePath), packageJson))
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return workspaces, nil
+}
+
+// GetWorkspacesNodeMajorVersion returns the highest offered major version
+// allowed by the engines.node range of every workspace. When there is none,
+// the error names the workspaces excluding the offered major version allowed
+// by most of them.
+//
+// Only major versions are offered, so a range is satisfied by a major version
+// when it allows any of its versions, e.g. >=18.17 by Node.js 18, as the
+// module streams ship the latest minor version of each major version.
+func GetWorkspacesNodeMajorVersion(workspaces []Workspace, offeredMajorVersions []uint64) (uint64, error) {
+	constraints := make([]*semver.Constraints, len(workspaces))
+	for i, workspace := range workspaces {
+		if workspace.NodeVersion == "" {
+			continue
+		}
+
+		constraint, err := semver.NewConstraint(workspace.NodeVersion)
+		if err != nil {
+			return 0, fmt.Errorf("invalid engines.node range %q of workspace %s: %w", workspace.NodeVersion, workspace.Name, err)
+		}
+		constraints[i] = constraint
+	}
+
+	var closestMajorVersion uint64
+	var closestExcludingWorkspaces []string
+	for _, majorVersion := range slices.Backward(offeredMajorVersions) {
+		var excludingWorkspaces []string
+		for i, workspace := range workspaces {
+			if constraints[i] != nil && !allowsMajorVersion(constraints[i], majorVersion) {
+				excludingWorkspaces = append(excludingWorkspaces, fmt.Sprintf("%s requires %s", workspace.Name, workspace.NodeVersion))
+			}
+		}
+
+		if len(excludingWorkspaces) == 0 {
+			return majorVersion, nil
+		}
+		if closestExcludingWorkspaces == nil || len(excludingWorkspaces) < len(closestExcludingWorkspaces) {
+			closestMajorVersion, closestExcludingWorkspaces = majorVersion, excludingWorkspaces
+		}
+	}
+
+	if closestExcludingWorkspaces == nil {
+		return 0, errors.New("no Node.js version is offered by the builder")
+	}
+
+	return 0, fmt.Errorf("no Node.js version offered by the builder satisfies the engines.node ranges of all the workspaces, Node.js %d is excluded by: %s", closestMajorVersion, strings.Join(closestExcludingWorkspaces, ", "))
+}
+
+func newWorkspace(relativePath string, packageJson *workspacePackageJson) Workspace {
+	name := packageJson.Name
+	if name == "" {
+		name = relativePath
+	}
+
+	return Workspace{Name: name, NodeVersion: packageJson.Engines.Node}
+}
+
+func readWorkspacePackageJson(workspacePath string) (*workspacePackageJson, error) {
+	content, err := os.ReadFile(filepath.Join(workspacePath, "package.json"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var packageJson workspacePackageJson
+	if err := json.Unmarshal(content, &packageJson); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", filepath.Join(workspacePath, "package.json"), err)
+	}
+
+	return &packageJson, nil
+}
+
+// getWorkspacePatterns reads the npm and yarn workspaces field, either a list
+// of patterns or an object with a packages list, falling back to the
+// pnpm-workspace.yaml file.
+func getWorkspacePatterns(projectPath string, workspacesField json.RawMessage) ([]string, error) {
+	if len(workspacesField) > 0 {
+		var patterns []string
+		if err := json.Unmarshal(workspacesField, &patterns); err == nil {
+			return patterns, nil
+		}
+
+		var workspacesObject struct {
+			Packages []string `json:"packages"`
+		}
+		if err := json.Unmarshal(workspacesField, &workspacesObject); err != nil {
+			return nil, fmt.Errorf("failed to parse the workspaces of package.json: %w", err)
+		}
+		return workspacesObject.Packages, nil
+	}
+
+	content, err := os.ReadFile(filepath.Join(projectPath, "pnpm-workspace.yaml"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var pnpmWorkspace pnpmWorkspaceYaml
+	if err := yaml.Unmarshal(content, &pnpmWorkspace); err != nil {
+		return nil, fmt.Errorf("failed to parse pnpm-workspace.yaml: %w", err)
+	}
+
+	return pnpmWorkspace.Packages, nil
+}
+
+// matchesWorkspacePatterns checks whether a directory is matched by one of the
+// patterns and not excluded by a later negated one.
+func matchesWorkspacePatterns(patterns []string, relativePath string) bool {
+	matched := false
+	for _, pattern := range patterns {
+		negated := strings.HasPrefix(pattern, "!")
+		pattern = path.Clean(strings.TrimPrefix(pattern, "!"))
+		if matchesWorkspacePattern(strings.Split(pattern, "/"), strings.Split(relativePath, "/")) {
+			matched = !negated
+		}
+	}
+
+	return matched
+}
+
+// mayContainWorkspaces checks whether a directory or one of its descendants
+// can be matched by one of the patterns, so that the other directories are not
+// walked.
+func mayContainWorkspaces(patterns []string, relativePath string) bool {
+	pathSegments := strings.Split(relativePath, "/")
+	for _, pattern := range patterns {
+		if strings.HasPrefix(pattern, "!") {
+			continue
+		}
+
+		patternSegments := strings.Split(path.Clean(pattern), "/")
+		for i, pathSegment := range pathSegments {
+			if i == len(patternSegments) {
+				break
+			}
+			if patternSegments[i] == "**" {
+				return true
+			}
+			if matched, err := path.Match(patternSegments[i], pathSegment); err != nil || !matched {
+				break
+			}
+			if i == len(pathSegments)-1 {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// matchesWorkspacePattern matches path segments, a ** segment matching any
+// number of them.
+func matchesWorkspacePattern(patternSegments []string, pathSegments []string) bool {
+	if len(patternSegments) == 0 {
+		return len(pathSegments) == 0
+	}
+
+	if patternSegments[0] == "**" {
+		for i := 0; i <= len(pathSegments); i++ {
+			if matchesWorkspacePattern(patternSegments[1:], pathSegments[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if len(pathSegments) == 0 {
+		return false
+	}
+
+	matched, err := path.Match(patternSegments[0], pathSegments[0])
+	return err == nil && matched && matchesWorkspacePattern(patternSegments[1:], pathSegments[1:])
+}
@@ -0,0 +1,159 @@
+package utils_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/paketo-buildpacks/ubi-nodejs-extension/internal/utils"
+	"github.com/sclevine/spec"
+)
+
+func testGetWorkspaces(t *testing.T, context spec.G, it spec.S) {
+
+	var (
+		Expect      = NewWithT(t).Expect
+		projectPath string
+	)
+
+	writePackageJson := func(workspacePath string, content string) {
+		Expect(os.MkdirAll(filepath.Join(projectPath, workspacePath), 0755)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(projectPath, workspacePath, "package.json"), []byte(content), 0644)).To(Succeed())
+	}
+
+	it.Before(func() {
+		projectPath = t.TempDir()
+	})
+
+	context("When the project does not declare any workspace", func() {
+
+		it("It should return no workspace", func() {
+			writePackageJson(".", `{"name": "app", "engines": {"node": ">=18"}}`)
+
+			Expect(utils.GetWorkspaces(projectPath)).To(BeNil())
+		})
+	})
+
+	context("When the npm workspaces field lists patterns", func() {
+
+		it.Before(func() {
+			writePackageJson(".", `{"name": "monorepo", "workspaces": ["packages/*", "tools/**", "!packages/legacy"]}`)
+			writePackageJson("packages/api", `{"name": "@acme/api", "engines": {"node": "^18 || ^20"}}`)
+			writePackageJson("packages/web", `{"engines": {"node": ">=20"}}`)
+			writePackageJson("packages/legacy", `{"name": "legacy", "engines": {"node": "14"}}`)
+			writePackageJson("packages/api/node_modules/dependency", `{"name": "dependency", "engines": {"node": "12"}}`)
+			writePackageJson("tools/scripts/lint", `{"name": "lint"}`)
+			writePackageJson("docs", `{"name": "docs", "engines": {"node": "16"}}`)
+		})
+
+		it("It should return the root and the matched workspaces", func() {
+			Expect(utils.GetWorkspaces(projectPath)).To(Equal([]utils.Workspace{
+				{Name: "monorepo"},
+				{Name: "@acme/api", NodeVersion: "^18 || ^20"},
+				{Name: "packages/web", NodeVersion: ">=20"},
+				{Name: "lint"},
+			}))
+		})
+	})
+
+	context("When the patterns nest several segments", func() {
+
+		it("It should only descend into the directories the patterns can match", func() {
+			writePackageJson(".", `{"name": "monorepo", "workspaces": ["apps/*/packages/*", "./libs/**"]}`)
+			writePackageJson("apps/web/packages/ui", `{"name": "ui"}`)
+			writePackageJson("apps/web/tools/build", `{"name": "build"}`)
+			writePackageJson("libs/core", `{"name": "core"}`)
+			writePackageJson("libs/core/utils", `{"name": "utils"}`)
+			writePackageJson("examples/apps/web/packages/demo", `{"name": "demo"}`)
+
+			Expect(utils.GetWorkspaces(projectPath)).To(Equal([]utils.Workspace{
+				{Name: "monorepo"},
+				{Name: "ui"},
+				{Name: "core"},
+				{Name: "utils"},
+			}))
+		})
+	})
+
+	context("When the yarn workspaces field is an object", func() {
+
+		it("It should read its packages", func() {
+			writePackageJson(".", `{"engines": {"node": ">=16"}, "workspaces": {"packages": ["apps/*"], "nohoist": ["**/react-native"]}}`)
+			writePackageJson("apps/mobile", `{"name": "mobile", "engines": {"node": "18"}}`)
+
+			Expect(utils.GetWorkspaces(projectPath)).To(Equal([]utils.Workspace{
+				{Name: ".", NodeVersion: ">=16"},
+				{Name: "mobile", NodeVersion: "18"},
+			}))
+		})
+	})
+
+	context("When the project is a pnpm workspace", func() {
+
+		it("It should read the packages of pnpm-workspace.yaml", func() {
+			writePackageJson(".", `{"name": "monorepo"}`)
+			writePackageJson("services/billing", `{"name": "billing", "engines": {"node": "20.x"}}`)
+			Expect(os.WriteFile(filepath.Join(projectPath, "pnpm-workspace.yaml"), []byte("packages:\n  - 'services/*'\n"), 0644)).To(Succeed())
+
+			Expect(utils.GetWorkspaces(projectPath)).To(Equal([]utils.Workspace{
+				{Name: "monorepo"},
+				{Name: "billing", NodeVersion: "20.x"},
+			}))
+		})
+	})
+
+	context("When a workspace package.json is not valid", func() {
+
+		it("It should fail", func() {
+			writePackageJson(".", `{"workspaces": ["packages/*"]}`)
+			writePackageJson("packages/api", `{"engines": `)
+
+			_, err := utils.GetWorkspaces(projectPath)
+			Expect(err).To(MatchError(ContainSubstring("failed to parse")))
+		})
+	})
+}
+
+func testGetWorkspacesNodeMajorVersion(t *testing.T, context spec.G, it spec.S) {
+
+	var (
+		Expect = NewWithT(t).Expect
+	)
+
+	context("When offered major versions satisfy every workspace", func() {
+
+		it("It should return the highest one", func() {
+			workspaces := []utils.Workspace{
+				{Name: "monorepo"},
+				{Name: "api", NodeVersion: "^18 || ^20"},
+				{Name: "web", NodeVersion: ">=18.17.0"},
+			}
+
+			Expect(utils.GetWorkspacesNodeMajorVersion(workspaces, []uint64{16, 18, 20, 22})).To(Equal(uint64(20)))
+		})
+	})
+
+	context("When no offered major version satisfies every workspace", func() {
+
+		it("It should name the workspaces excluding the closest major version", func() {
+			workspaces := []utils.Workspace{
+				{Name: "monorepo", NodeVersion: ">=18"},
+				{Name: "api", NodeVersion: "^18"},
+				{Name: "web", NodeVersion: ">=20"},
+				{Name: "worker", NodeVersion: ">=20"},
+			}
+
+			_, err := utils.GetWorkspacesNodeMajorVersion(workspaces, []uint64{18, 20})
+			Expect(err).To(MatchError("no Node.js version offered by the builder satisfies the engines.node ranges of all the workspaces, Node.js 20 is excluded by: api requires ^18"))
+		})
+	})
+
+	context("When a workspace range is not valid", func() {
+
+		it("It should fail", func() {
+			_, err := utils.GetWorkspacesNodeMajorVersion([]utils.Workspace{{Name: "api", NodeVersion: "not a range"}}, []uint64{20})
+			Expect(err).To(MatchError(ContainSubstring(`invalid engines.node range "not a range" of workspace api`)))
+		})
+	})
+}
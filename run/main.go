@@ -5,22 +5,29 @@ import (
 
 	"github.com/paketo-buildpacks/packit/v2"
 	"github.com/paketo-buildpacks/packit/v2/cargo"
+	"github.com/paketo-buildpacks/packit/v2/chronos"
 	"github.com/paketo-buildpacks/packit/v2/postal"
 	"github.com/paketo-buildpacks/packit/v2/scribe"
 
 	ubinodejsextension "github.com/paketo-buildpacks/ubi-nodejs-extension"
+	"github.com/paketo-buildpacks/ubi-nodejs-extension/constants"
 	"github.com/paketo-buildpacks/ubi-nodejs-extension/internal/utils"
+	"github.com/paketo-buildpacks/ubi-nodejs-extension/structs"
 )
 
-const IMAGES_JSON_PATH = "/etc/buildpacks/images.json"
-
 func main() {
 	dependencyManager := postal.NewService(cargo.NewTransport())
 	logEmitter := scribe.NewEmitter(os.Stdout).WithLevel(os.Getenv("BP_LOG_LEVEL"))
 	duringBuildPermissions := utils.GetDuringBuildPermissions("/etc/passwd")
+	buildImage := structs.BuildImage{
+		Distro:         utils.GetTargetDistro(constants.OS_RELEASE_PATH),
+		PackageManager: utils.DetectPackageManager("/usr/bin").Name,
+		NodeBinary:     "node",
+		RpmBinary:      "rpm",
+	}
 
 	packit.RunExtension(
 		ubinodejsextension.Detect(),
-		ubinodejsextension.Generate(dependencyManager, logEmitter, duringBuildPermissions, IMAGES_JSON_PATH),
+		ubinodejsextension.Generate(dependencyManager, logEmitter, duringBuildPermissions, constants.IMAGES_JSON_PATH, buildImage, chronos.DefaultClock),
 	)
 }
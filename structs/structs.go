@@ -4,12 +4,96 @@ type DuringBuildPermissions struct {
 	CNB_USER_ID, CNB_GROUP_ID int
 }
 
+// Distro is the distribution of the build image, as reported by the
+// CNB_TARGET_DISTRO_* variables or its /etc/os-release file.
+type Distro struct {
+	Name, Version string
+}
+
+// BuildImage describes the build image the extension is running on.
+type BuildImage struct {
+	Distro         Distro
+	PackageManager string
+	// NodeBinary and RpmBinary are run to probe the Node.js version and the rpm
+	// packages already installed, they are not probed when empty
+	NodeBinary string
+	RpmBinary  string
+}
+
+// PackageManagerCommands are the command lines of a package manager used on
+// the generated Dockerfiles.
+type PackageManagerCommands struct {
+	EnableModule, Install, Clean string
+}
+
+// UbiDistro describes how Node.js is delivered on a major version of UBI.
+type UbiDistro struct {
+	// ModuleStreams is true when the Node.js versions are delivered as nodejs module streams
+	ModuleStreams bool
+	// DefaultNodeVersion is the Node.js major version of the plain nodejs package
+	DefaultNodeVersion uint64
+	Packages           string
+}
+
+type CACertificate struct {
+	Name, Content string
+}
+
 type BuildDockerfileProps struct {
 	NODEJS_VERSION            uint64
 	CNB_USER_ID, CNB_GROUP_ID int
 	CNB_STACK_ID, PACKAGES    string
+	CNB_TARGET                string
+	NODEJS_PROFILE            string
+	NODEJS_INSTALLED          bool
+	NODEJS_HEADERS            bool
+	NON_MODULAR               bool
+	PACKAGE_MANAGER           PackageManagerCommands
+	FIPS                      bool
+	FULL_ICU                  bool
+	NPM_PACKAGE               string
+	NPM_REGISTRY              string
+	CA_CERTIFICATES           []CACertificate
+	GENERATE_REPORT           bool
 }
 
 type RunDockerfileProps struct {
-	Source string
+	Source                    string
+	Labels                    map[string]string
+	CNB_USER_ID, CNB_GROUP_ID int
+	FIPS                      bool
+	FULL_ICU                  bool
+	PACKAGES                  string
+	PACKAGE_MANAGER           PackageManagerCommands
+}
+
+type GenerateReport struct {
+	NodeRequestedVersion string   `toml:"node-requested-version" json:"node-requested-version"`
+	NodeVersionSource    string   `toml:"node-version-source" json:"node-version-source"`
+	DefaultVersionPolicy string   `toml:"default-version-policy" json:"default-version-policy"`
+	NodeVersionFallback  string   `toml:"node-version-fallback" json:"node-version-fallback"`
+	NodeVersionConflicts []string `toml:"node-version-conflicts" json:"node-version-conflicts"`
+	NodeMajorVersion     uint64   `toml:"node-major-version" json:"node-major-version"`
+	NodeProfile          string   `toml:"node-profile" json:"node-profile"`
+	NodeLaunch           bool     `toml:"node-launch" json:"node-launch"`
+	NodePreinstalled     bool     `toml:"node-preinstalled" json:"node-preinstalled"`
+	NpmVersion           string   `toml:"npm-version" json:"npm-version"`
+	NpmVersionSource     string   `toml:"npm-version-source" json:"npm-version-source"`
+	RunImage             string   `toml:"run-image" json:"run-image"`
+	RunImageSource       string   `toml:"run-image-source" json:"run-image-source"`
+	Packages             []string `toml:"packages" json:"packages"`
+	ImagesJsonPath       string   `toml:"images-json-path" json:"images-json-path"`
+	Platform             string   `toml:"platform" json:"platform"`
+	Distro               string   `toml:"distro" json:"distro"`
+	DistroVersion        string   `toml:"distro-version" json:"distro-version"`
+	PackageManager       string   `toml:"package-manager" json:"package-manager"`
+	BuildTemplate        string   `toml:"build-template" json:"build-template"`
+	RunTemplate          string   `toml:"run-template" json:"run-template"`
+	BuildFragments       []string `toml:"build-fragments" json:"build-fragments"`
+	RunFragments         []string `toml:"run-fragments" json:"run-fragments"`
+	FIPS                 bool     `toml:"fips" json:"fips"`
+	FullICU              bool     `toml:"full-icu" json:"full-icu"`
+	CACertificates       []string `toml:"ca-certificates" json:"ca-certificates"`
+	NativePackages       []string `toml:"native-packages" json:"native-packages"`
+	RunPackages          []string `toml:"run-packages" json:"run-packages"`
 }